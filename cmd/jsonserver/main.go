@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/OleKodehode/go-json-server/internal/app"
+	"github.com/OleKodehode/go-json-server/internal/config"
 	"github.com/OleKodehode/go-json-server/internal/db"
 	"github.com/OleKodehode/go-json-server/internal/model"
 	"github.com/OleKodehode/go-json-server/internal/service"
@@ -16,6 +23,29 @@ func main() {
 	// setup of logger using slog
 	logger := slog.Default()
 
+	// Any file path works - DB_PATH for environments where flags are awkward to pass
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = db.DefaultPath
+	}
+	flag.StringVar(&dbPath, "db", dbPath, "Path to the database file (env: DB_PATH)")
+	configPath := flag.String("config", "", "Path to a JSON config file with per-collection settings (ID strategy, primary key)")
+
+	// Storage options - Rewriting the whole file on every write is the default
+	journal := flag.Bool("journal", false, "Append changes to a journal instead of rewriting the database file on every write")
+	compactThreshold := flag.Int64("compact-threshold", db.DefaultCompactThreshold, "Journal size in bytes that triggers a compaction into the database file")
+	writeBehind := flag.Bool("write-behind", false, "Save in the background instead of on every write (write-through)")
+	flushInterval := flag.Duration("flush-interval", db.DefaultFlushInterval, "How often pending changes are saved in write-behind mode")
+	flushAfter := flag.Int("flush-after", db.DefaultFlushAfter, "Save as soon as this many changes are pending in write-behind mode")
+	memory := flag.Bool("memory", false, "Keep every change in memory - The database file is only read as a seed and never written")
+	watch := flag.Bool("watch", false, "Reload the database file when it's edited on disk while the server runs")
+	watchInterval := flag.Duration("watch-interval", db.DefaultWatchInterval, "How often the database file is checked for changes in watch mode")
+
+	// Request handling
+	readOnly := flag.Bool("read-only", false, "Reject every POST/PUT/PATCH/DELETE request with 405")
+	strict := flag.Bool("strict", false, "Reject list queries with unknown parameters or unusable values with 400 instead of a warning header")
+	flag.Parse()
+
 	port := os.Getenv("PORT")
 	if port == "" { // dev env
 		port = "8080"
@@ -26,20 +56,72 @@ func main() {
 		host = "localhost"
 	}
 
-	db, err := db.Load[model.Data]("db")
+	// No config file - Every collection uses incrementing IDs keyed by "id"
+	var cfg config.Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			logger.Error("Failure to load config", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	db, err := db.LoadWithOptions[model.Data](dbPath, db.Options{
+		Journal:          *journal,
+		CompactThreshold: *compactThreshold,
+		WriteBehind:      *writeBehind,
+		FlushInterval:    *flushInterval,
+		FlushAfter:       *flushAfter,
+		Watch:            *watch,
+		WatchInterval:    *watchInterval,
+		Memory:           *memory,
+		PrimaryKey:       cfg.PrimaryKey,
+	})
 	if err != nil {
-		logger.Error("Failure to load DB - ", "Database Error: ", err)
+		logger.Error("Failure to load DB - ", "path", dbPath, "Database Error: ", err)
 		os.Exit(1)
 	}
 
-	serviceLayer := service.New(db)
+	serviceLayer, err := service.NewWithConfig(db, cfg)
+	if err != nil {
+		logger.Error("Invalid config", "path", *configPath, "error", err)
+		os.Exit(1)
+	}
 
-	router := app.NewRouter(serviceLayer)
+	router := app.NewRouter(serviceLayer, app.Config{ReadOnly: *readOnly, Strict: *strict})
 
-	logger.Info("Server starting", "port", port)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+
+	// Stop on Ctrl+C / SIGTERM, so the DB gets a chance to save what's pending
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Closed once Shutdown has returned - Every request still running by then has finished (or timed out)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Info("Shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Requests still running after the shutdown timeout", "error", err)
+		}
+	}()
+
+	logger.Info("Server starting", "port", port, "db", db.Path, "journal", *journal, "write_behind", *writeBehind, "watch", *watch, "memory", *memory, "read_only", *readOnly, "strict", *strict)
 	fmt.Printf("http://%s:%s/", host, port) // convenience log
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("Server failed to start", "error", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+
+	// ListenAndServe returns as soon as Shutdown starts - Let the requests in flight commit before the DB closes
+	<-shutdownDone
+
+	if err := db.Close(); err != nil {
+		logger.Error("Failure to save DB on shutdown", "error", err)
+		os.Exit(1)
+	}
+}
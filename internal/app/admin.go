@@ -0,0 +1,51 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/OleKodehode/go-json-server/internal/service"
+)
+
+// POST /__reset (memory mode only)
+func (h *Handler) Reset(w http.ResponseWriter, r *http.Request) {
+	err := h.Service.Reset()
+	if errors.Is(err, service.ErrNotInMemory) {
+		RespondError(w, http.StatusConflict, "Reset is only available when the server runs in memory mode (--memory)")
+		return
+	}
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	RespondJSON(w, http.StatusNoContent, nil)
+}
+
+// IndexRequest is the body of POST /__indexes
+type IndexRequest struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+}
+
+// GET /__indexes -> The indexed fields by collection
+func (h *Handler) Indexes(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, h.Service.Indexes())
+}
+
+// POST /__indexes -> Adds a secondary index on a field: {"collection": "orders", "field": "status"}
+func (h *Handler) AddIndex(w http.ResponseWriter, r *http.Request) {
+	var body IndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON object with a collection and a field")
+		return
+	}
+
+	if err := h.Service.AddIndex(body.Collection, body.Field); err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	RespondJSON(w, http.StatusCreated, h.Service.Indexes())
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/OleKodehode/go-json-server/internal/service"
+)
+
+// One entry per operation in the response of a bulk request
+type BulkResultResponse struct {
+	Op     string         `json:"op"`
+	ID     string         `json:"id,omitempty"`
+	Status int            `json:"status"`
+	Data   map[string]any `json:"data,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Applied bool                 `json:"applied"`
+	Error   string               `json:"error,omitempty"`
+	Results []BulkResultResponse `json:"results"`
+}
+
+// POST /:name/_bulk (collection)
+// Body is a list of operations: [{"op":"create","data":{...}}, {"op":"update","id":"1","data":{...}}, {"op":"delete","id":"2"}]
+func (h *Handler) Bulk(w http.ResponseWriter, r *http.Request) {
+	collection := r.PathValue("name")
+
+	ops := []service.BulkOp{}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON array of operations")
+		return
+	}
+
+	results, err := h.Service.Bulk(collection, ops)
+	if err != nil && !errors.Is(err, service.ErrBulkFailed) {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	response := BulkResponse{Applied: err == nil, Results: make([]BulkResultResponse, len(results))}
+	for i, result := range results {
+		response.Results[i] = BulkResultResponse{Op: result.Op, ID: result.ID, Data: result.Item, Status: bulkStatus(result)}
+		if result.Err != nil {
+			response.Results[i].Error = result.Err.Error()
+		}
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+		RespondJSON(w, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// bulkStatus is the status code the operation would have gotten as a request of its own
+func bulkStatus(result service.BulkResult) int {
+	if result.Err != nil {
+		return errorStatus(result.Err)
+	}
+
+	switch result.Op {
+	case service.BulkCreate:
+		return http.StatusCreated
+	case service.BulkDelete:
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
+}
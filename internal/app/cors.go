@@ -9,8 +9,8 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, ETag, X-Query-Warning")
 
 		if r.Method == http.MethodOptions {
 			RespondJSON(w, http.StatusNoContent, nil)
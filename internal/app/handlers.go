@@ -2,7 +2,9 @@ package app
 
 import (
 	"encoding/json"
+	"maps"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/OleKodehode/go-json-server/internal/service"
@@ -11,54 +13,52 @@ import (
 // These endpoints needs to communicate with the service layer - Needs a pointer to it
 type Handler struct {
 	Service *service.Service
+	// Strict answers list requests with a query problem (unknown parameter, bad number etc) with a 400, instead of a warning header
+	Strict bool
 }
 
 func NewHandler(s *service.Service) *Handler {
 	return &Handler{Service: s}
 }
 
-// GET /:name (collection)
+// GET /:name (collection or singular resource)
 func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 	collection := r.PathValue("name")
 	query := r.URL.Query()
 
-	params := map[string]string{}
-	for key, values := range query {
-		if len(values) > 0 {
-			params[key] = strings.TrimSpace(values[0])
-		}
+	// Singular resources are returned as they are - No filtering or paging on a single object
+	if item, ok := h.Service.GetResource(collection); ok {
+		respondCached(w, r, service.ETag(item), item)
+		return
 	}
 
-	controls := map[string]string {
-		"_page" : params["_page"],
-		"_per_page" : params["_per_page"],
-		"_limit" : params["_limit"],
-		"_sort" : params["_sort"],
-		"_q" : params["_q"],	// full text search
+	params, controls := listParams(query)
+	filters := service.CompileFilters(params)
+	if !h.checkQuery(w, collection, query, filters) {
+		return
 	}
 
-	filters := map[string]string{}
-	for key, value := range params {
-			if value != "" && !strings.HasPrefix(key, "_") {
-				filters[key] = value
-			}
+	items, total, err := h.Service.GetAll(collection, filters, controls)
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
 	}
-	items, total := h.Service.GetAll(collection, filters, controls)
 	totalHeader(w, total)
-	RespondJSON(w, http.StatusOK, items)
+	// Weak - The tag covers this page (and the total), not the entries themselves
+	respondCached(w, r, service.WeakETag([]any{total, items}), items)
 }
 
 // get /:name/:id (collection/entry)
 func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 	collection := r.PathValue("name")
 	id := r.PathValue("id")
-	item := h.Service.GetByID(collection, id)
+	item := h.Service.GetByID(collection, id, relationControls(r.URL.Query()))
 	if item == nil {
 		RespondError(w, http.StatusNotFound, "Entry not found")
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, item)
+	respondCached(w, r, service.ETag(item), item)
 }
 
 // POST /:name (collection)
@@ -70,11 +70,11 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 
 	item, err := h.Service.Create(collection, body)
 	if err != nil {
-		RespondError(w, http.StatusNotFound, err.Error())
+		RespondError(w, errorStatus(err), err.Error())
 		return
 	}
 
-	RespondJSON(w, http.StatusCreated, item)
+	respondEntry(w, http.StatusCreated, item)
 }
 
 // PUT /:name/:id (collection/entry)
@@ -85,42 +85,230 @@ func (h *Handler) Replace(w http.ResponseWriter, r *http.Request) {
 	body := map[string]any{}
 	json.NewDecoder(r.Body).Decode(&body)
 
-	item, err := h.Service.Replace(collection, id, body)
+	item, err := h.Service.Replace(collection, id, body, r.Header.Get("If-Match"))
 	if err != nil {
-		RespondError(w, http.StatusNotFound, err.Error())
+		RespondError(w, errorStatus(err), err.Error())
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, item)
+	respondEntry(w, http.StatusOK, item)
 }
 
 // PATCH /:name/:id (collection/entry)
+// application/json-patch+json bodies are applied as a JSON Patch (RFC 6902),
+// application/merge-patch+json bodies as a JSON Merge Patch (RFC 7396).
+// Anything else keeps the original behaviour - The top level fields of the body replace the ones in the entry.
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	collection := r.PathValue("name")
 	id := r.PathValue("id")
 
+	contentType := mediaType(r)
+	if contentType == "application/json-patch+json" {
+		h.jsonPatch(w, r, collection, id)
+		return
+	}
+
 	body := map[string]any{}
 	json.NewDecoder(r.Body).Decode(&body)
 
-	item, err := h.Service.Update(collection, id, body)
+	var (
+		item map[string]any
+		err  error
+	)
+	if contentType == "application/merge-patch+json" {
+		item, err = h.Service.MergePatch(collection, id, body, r.Header.Get("If-Match"))
+	} else {
+		item, err = h.Service.Update(collection, id, body, r.Header.Get("If-Match"))
+	}
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	respondEntry(w, http.StatusOK, item)
+}
+
+// jsonPatch handles a PATCH with a JSON Patch body - A list of add/remove/replace/move/copy/test operations
+func (h *Handler) jsonPatch(w http.ResponseWriter, r *http.Request, collection string, id string) {
+	ops := []service.PatchOp{}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON array of JSON Patch operations")
+		return
+	}
+
+	item, err := h.Service.JSONPatch(collection, id, ops, r.Header.Get("If-Match"))
 	if err != nil {
-		RespondError(w, http.StatusNotFound, err.Error())
+		RespondError(w, errorStatus(err), err.Error())
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, item)
+	respondEntry(w, http.StatusOK, item)
+}
+
+// Body of a DELETE with _dependent - How many entries were removed from each collection
+type DeleteResponse struct {
+	Removed map[string]int `json:"removed"`
 }
 
 // DELETE /:name/:id (collection/entry)
+// ?_dependent=comments (repeatable) also deletes the comments pointing to the entry
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	collection := r.PathValue("name")
 	id := r.PathValue("id")
+	dependents := splitParams(r.URL.Query()["_dependent"])
+
+	removed, err := h.Service.Delete(collection, id, dependents, r.Header.Get("If-Match"))
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	// Plain deletes stay plain - Only a cascade has something to report
+	if len(dependents) == 0 {
+		RespondJSON(w, http.StatusNoContent, nil)
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, DeleteResponse{Removed: removed})
+}
+
+// PUT /:name (entire collection or singular resource)
+// An array replaces the whole collection, an object replaces (or creates) a singular resource.
+func (h *Handler) ReplaceName(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var body any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON array (collection) or object (singular resource)")
+		return
+	}
+
+	switch value := body.(type) {
+	case []any:
+		result, err := h.Service.ReplaceCollection(name, value)
+		if err != nil {
+			RespondError(w, errorStatus(err), err.Error())
+			return
+		}
+		RespondJSON(w, http.StatusOK, result)
+	case map[string]any:
+		item, err := h.Service.ReplaceResource(name, value, r.Header.Get("If-Match"))
+		if err != nil {
+			RespondError(w, errorStatus(err), err.Error())
+			return
+		}
+		respondEntry(w, http.StatusOK, item)
+	default:
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON array (collection) or object (singular resource)")
+	}
+}
+
+// PATCH /:name (every matching entry in a collection, or a singular resource)
+// For a collection, the query string filters which entries get updated - Same syntax as GET.
+func (h *Handler) UpdateName(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	body := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		RespondError(w, http.StatusBadRequest, "Body must be a JSON object")
+		return
+	}
+
+	if _, isResource := h.Service.GetResource(name); isResource {
+		update := h.Service.UpdateResource
+		if mediaType(r) == "application/merge-patch+json" {
+			update = h.Service.MergePatchResource
+		}
+
+		item, err := update(name, body, r.Header.Get("If-Match"))
+		if err != nil {
+			RespondError(w, errorStatus(err), err.Error())
+			return
+		}
+		respondEntry(w, http.StatusOK, item)
+		return
+	}
+
+	filters, _ := listParams(r.URL.Query())
+	items, err := h.Service.UpdateCollection(name, filters, body)
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	totalHeader(w, len(items))
+	RespondJSON(w, http.StatusOK, items)
+}
+
+// relationControls collects _embed, _expand and _fields from the query. They can be repeated (?_embed=comments&_embed=likes)
+// or comma separated, so every value is kept - Not just the first one like the other parameters.
+func relationControls(query url.Values) map[string]string {
+	return map[string]string{
+		"_embed":  strings.Join(query["_embed"], ","),
+		"_expand": strings.Join(query["_expand"], ","),
+		"_fields": strings.Join(query["_fields"], ","),
+	}
+}
+
+// listParams splits the query of a list request into filters and controls (the parameters starting with _)
+func listParams(query url.Values) (map[string]string, map[string]string) {
+	params := map[string]string{}
+	for key, values := range query {
+		if len(values) > 0 {
+			params[key] = strings.TrimSpace(values[0])
+		}
+	}
+
+	controls := map[string]string {
+		"_page" : params["_page"],
+		"_per_page" : params["_per_page"],
+		"_limit" : params["_limit"],
+		"_sort" : params["_sort"],
+		"_q" : params["_q"],	// full text search
+	}
+	maps.Copy(controls, relationControls(query))
+
+	filters := map[string]string{}
+	for key, value := range params {
+			if value != "" && !strings.HasPrefix(key, "_") {
+				filters[key] = value
+			}
+	}
+
+	return filters, controls
+}
+
+// DELETE /:name (every entry in a collection matching the query filters)
+// Refuses to run without filters unless ?_confirm=true is given, so a stray request can't wipe a collection.
+func (h *Handler) DeleteWhere(w http.ResponseWriter, r *http.Request) {
+	collection := r.PathValue("name")
+	query := r.URL.Query()
+
+	filters, _ := listParams(query)
+	if len(filters) == 0 && query.Get("_confirm") != "true" {
+		RespondError(w, http.StatusBadRequest, "Refusing to delete every entry without filters - Add ?_confirm=true if that's what you want")
+		return
+	}
 
-	err := h.Service.Delete(collection, id)
+	removed, err := h.Service.DeleteWhere(collection, filters)
 	if err != nil {
-		RespondError(w, http.StatusNotFound, err.Error())
+		RespondError(w, errorStatus(err), err.Error())
 		return
 	}
 
-	RespondJSON(w, http.StatusNoContent, nil)
-}
\ No newline at end of file
+	RespondJSON(w, http.StatusOK, DeleteResponse{Removed: removed})
+}
+
+// splitParams flattens a repeated and/or comma separated query parameter (?a=x,y&a=z -> [x y z])
+func splitParams(values []string) []string {
+	var parts []string
+	for _, value := range values {
+		for part := range strings.SplitSeq(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+
+	return parts
+}
@@ -5,10 +5,14 @@ import (
 )
 
 // simple endpoint to check if the server is running - No need to add service to this
+// Also tells the index page which mode the server runs in.
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status   string `json:"status"`
+	ReadOnly bool   `json:"readOnly"`
 }
 
-func HandleHealth(w http.ResponseWriter, r *http.Request) {
-	RespondJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
-}
\ No newline at end of file
+func HandleHealth(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(w, http.StatusOK, HealthResponse{Status: "ok", ReadOnly: cfg.ReadOnly})
+	}
+}
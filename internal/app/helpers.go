@@ -2,8 +2,12 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
+
+	"github.com/OleKodehode/go-json-server/internal/service"
 )
 
 // Helper function
@@ -28,7 +32,56 @@ func RespondError(w http.ResponseWriter, status int, message string) {
 	RespondJSON(w, status, ErrorMessage{Error:message})
 }
 
+// respondEntry sends a single entry along with its ETag, so the client can use it for If-Match right away
+func respondEntry(w http.ResponseWriter, status int, item map[string]any) {
+	w.Header().Set("ETag", service.ETag(item))
+	RespondJSON(w, status, item)
+}
+
+// respondCached sends data with its ETag, or just a 304 if the client's If-None-Match says it already has it
+func respondCached(w http.ResponseWriter, r *http.Request, etag string, data any) {
+	w.Header().Set("ETag", etag)
+	if service.MatchesIfNoneMatch(etag, r.Header.Get("If-None-Match")) {
+		RespondJSON(w, http.StatusNotModified, nil)
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, data)
+}
+
+// errorStatus picks the status code for an error returned by the service layer
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidBody), errors.Is(err, service.ErrUnknownOp), errors.Is(err, service.ErrMissingID),
+		errors.Is(err, service.ErrInvalidIndex), errors.Is(err, service.ErrInvalidFilter):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrIsResource), errors.Is(err, service.ErrIsCollection),
+		errors.Is(err, service.ErrPatchTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrInvalidPatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrNotApplied):
+		return http.StatusFailedDependency
+	case errors.Is(err, service.ErrCollectionNotFound), errors.Is(err, service.ErrEntryNotFound),
+		errors.Is(err, service.ErrResourceNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// mediaType returns the request's Content-Type without parameters (application/json; charset=utf-8 -> application/json)
+func mediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
 func totalHeader(w http.ResponseWriter, total int) {
 	w.Header().Set("X-Total-Count", strconv.Itoa(total))
-	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, ETag, X-Query-Warning")
 }
\ No newline at end of file
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/OleKodehode/go-json-server/internal/service"
+)
+
+// GET /:name/:id/:child (entries of child belonging to collection/entry)
+func (h *Handler) GetNested(w http.ResponseWriter, r *http.Request) {
+	parent := r.PathValue("name")
+	id := r.PathValue("id")
+	child := r.PathValue("child")
+
+	query := r.URL.Query()
+	params, controls := listParams(query)
+	filters := service.CompileFilters(params)
+	if !h.checkQuery(w, child, query, filters) {
+		return
+	}
+
+	items, total, err := h.Service.GetNested(parent, id, child, filters, controls)
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	totalHeader(w, total)
+	RespondJSON(w, http.StatusOK, items)
+}
+
+// POST /:name/:id/:child (new entry in child belonging to collection/entry)
+func (h *Handler) CreateNested(w http.ResponseWriter, r *http.Request) {
+	parent := r.PathValue("name")
+	id := r.PathValue("id")
+	child := r.PathValue("child")
+
+	body := map[string]any{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	item, err := h.Service.CreateNested(parent, id, child, body)
+	if err != nil {
+		RespondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	respondEntry(w, http.StatusCreated, item)
+}
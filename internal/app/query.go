@@ -0,0 +1,79 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/OleKodehode/go-json-server/internal/service"
+)
+
+// QueryErrorResponse is the 400 a strict server answers an invalid query with
+type QueryErrorResponse struct {
+	Error    string                 `json:"error"`
+	Problems []service.QueryProblem `json:"problems"`
+}
+
+// listControls are the control parameters GET /:name understands - Any other parameter starting with _ is a typo
+var listControls = map[string]bool{
+	"_page": true, "_per_page": true, "_limit": true, "_sort": true, "_q": true,
+	"_embed": true, "_expand": true, "_fields": true,
+}
+
+// checkQuery validates the query of a list request. In strict mode the problems are answered with a 400 and false
+// is returned - The handler has to stop. Otherwise they're passed along as X-Query-Warning headers.
+// filters are the compiled filters of the query, the same ones the handler passes on to the service.
+func (h *Handler) checkQuery(w http.ResponseWriter, collection string, query url.Values, filters service.Filters) bool {
+	problems := append(controlProblems(query), service.ValidateFilters(filters)...)
+	// Misspelled operators on dotted paths are looked for in the entries themselves - Only worth it when the answer is a 400
+	problems = append(problems, h.Service.UnknownOperators(collection, filters, h.Strict)...)
+	if len(problems) == 0 {
+		return true
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Parameter < problems[j].Parameter })
+
+	if h.Strict {
+		RespondJSON(w, http.StatusBadRequest, QueryErrorResponse{Error: "Invalid query", Problems: problems})
+		return false
+	}
+
+	for _, problem := range problems {
+		// %+q keeps the header ASCII whatever the value holds
+		w.Header().Add("X-Query-Warning", fmt.Sprintf("%s=%+q: %s", problem.Parameter, problem.Value, problem.Reason))
+	}
+	return true
+}
+
+// controlProblems looks for control parameters that are misspelled or hold something that isn't usable,
+// and filters without a value. All of them would otherwise be ignored without a word.
+func controlProblems(query url.Values) []service.QueryProblem {
+	problems := []service.QueryProblem{}
+
+	for key, values := range query {
+		value := ""
+		if len(values) > 0 {
+			value = strings.TrimSpace(values[0])
+		}
+
+		switch {
+		case !strings.HasPrefix(key, "_"):
+			if value == "" {
+				problems = append(problems, service.QueryProblem{Parameter: key, Value: value, Reason: "filter without a value is ignored"})
+			}
+		case !listControls[key]:
+			problems = append(problems, service.QueryProblem{Parameter: key, Value: value, Reason: "unknown parameter"})
+		case key == "_page", key == "_per_page", key == "_limit":
+			if value == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(value); err != nil || n < 1 {
+				problems = append(problems, service.QueryProblem{Parameter: key, Value: value, Reason: "must be a whole number of 1 or more"})
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,20 @@
+package app
+
+import (
+	"net/http"
+)
+
+// ReadOnlyMiddleware turns away every request that would change the data.
+// GET (health, static and the API itself) keeps working - OPTIONS is answered by the CORS middleware before this.
+func ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			RespondError(w, http.StatusMethodNotAllowed, "Server is running in read-only mode")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -6,12 +6,28 @@ import (
 	"github.com/OleKodehode/go-json-server/internal/service"
 )
 
-func NewRouter(s *service.Service) http.Handler {
+// Config holds the server-wide switches that change how requests are handled
+type Config struct {
+	// ReadOnly rejects POST/PUT/PATCH/DELETE with 405 - Reading keeps working
+	ReadOnly bool
+	// Strict rejects list queries with unknown parameters or unusable values with a 400
+	Strict bool
+}
+
+func NewRouter(s *service.Service, cfg Config) http.Handler {
 	mux := http.NewServeMux()
 	h := NewHandler(s)
+	h.Strict = cfg.Strict
 	
 	// health check
-	mux.HandleFunc("GET /health", HandleHealth)
+	mux.HandleFunc("GET /health", HandleHealth(cfg))
+
+	// Admin - Back to the seed data in memory mode
+	mux.HandleFunc("POST /__reset", h.Reset)
+
+	// Admin - Secondary indexes for equality filters
+	mux.HandleFunc("GET /__indexes", h.Indexes)
+	mux.HandleFunc("POST /__indexes", h.AddIndex)
 
 	// Serve the same index.html file that the original used. No need for a handler
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
@@ -25,15 +41,32 @@ func NewRouter(s *service.Service) http.Handler {
 	// Create new collections
 	mux.HandleFunc("POST /{name}", h.Create)
 
+	// Several creates/updates/deletes in a single write
+	mux.HandleFunc("POST /{name}/_bulk", h.Bulk)
+
 	// Update entries
 	mux.HandleFunc("PUT /{name}/{id}", h.Replace)
 	mux.HandleFunc("PATCH /{name}/{id}", h.Update)
 
+	// Replace or update whole collections, or singular resources (top level objects like /profile)
+	mux.HandleFunc("PUT /{name}", h.ReplaceName)
+	mux.HandleFunc("PATCH /{name}", h.UpdateName)
+
+	// Nested routes - Children of an entry, matched by foreign key (/posts/1/comments -> comments with postId 1)
+	mux.HandleFunc("GET /{name}/{id}/{child}", h.GetNested)
+	mux.HandleFunc("POST /{name}/{id}/{child}", h.CreateNested)
+
 	// Delete entries
 	mux.HandleFunc("DELETE /{name}/{id}", h.Delete)
+	mux.HandleFunc("DELETE /{name}", h.DeleteWhere)
+
+	var handler http.Handler = mux
+	if cfg.ReadOnly {
+		handler = ReadOnlyMiddleware(handler)
+	}
 
 	// Alternatively, wrap cors outside to omit OPTIONS requests logging
-	return LoggingMiddleWare(CORSMiddleware(mux))
+	return LoggingMiddleWare(CORSMiddleware(handler))
 
 }
 
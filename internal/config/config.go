@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Built-in defaults for collections the config doesn't mention
+const (
+	DefaultPrimaryKey = "id"
+	DefaultIDStrategy = "increment"
+)
+
+// Config is the optional JSON config file (--config) with per-collection settings:
+//
+//	{
+//	  "defaults":    { "idStrategy": "increment" },
+//	  "collections": { "users": { "idStrategy": "uuidv7", "primaryKey": "_id", "indexes": ["role"] } }
+//	}
+type Config struct {
+	Defaults    Collection            `json:"defaults"`
+	Collections map[string]Collection `json:"collections"`
+}
+
+// Collection holds the settings for a single collection. Empty fields fall back to the defaults.
+type Collection struct {
+	// IDStrategy picks how new IDs are generated: increment, uuidv4, uuidv7, ulid or nanoid
+	IDStrategy string `json:"idStrategy,omitempty"`
+	// PrimaryKey is the field entries are looked up by (/users/{id} matches users by it). Defaults to "id".
+	PrimaryKey string `json:"primaryKey,omitempty"`
+	// Indexes lists top level fields to keep a secondary index on, for fast equality filters (?status=active)
+	Indexes []string `json:"indexes,omitempty"`
+}
+
+// Load reads the config file at path
+func Load(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// Collection names in requests are trimmed and lowercased - The keys have to be as well, or " Users" never applies
+	collections := make(map[string]Collection, len(cfg.Collections))
+	for name, settings := range cfg.Collections {
+		normalized := strings.ToLower(strings.TrimSpace(name))
+		if _, duplicate := collections[normalized]; duplicate {
+			return cfg, fmt.Errorf("config file %s: collection %q is listed more than once", path, normalized)
+		}
+		collections[normalized] = settings
+	}
+	cfg.Collections = collections
+
+	return cfg, nil
+}
+
+// Collection returns the settings for a collection, with the defaults filled in
+func (c Config) Collection(name string) Collection {
+	settings := c.Collections[name]
+
+	if settings.IDStrategy == "" {
+		settings.IDStrategy = c.Defaults.IDStrategy
+	}
+	if settings.IDStrategy == "" {
+		settings.IDStrategy = DefaultIDStrategy
+	}
+
+	if settings.PrimaryKey == "" {
+		settings.PrimaryKey = c.Defaults.PrimaryKey
+	}
+	if settings.PrimaryKey == "" {
+		settings.PrimaryKey = DefaultPrimaryKey
+	}
+
+	return settings
+}
+
+// PrimaryKey returns the primary key field of a collection - Handy as db.Options.PrimaryKey
+func (c Config) PrimaryKey(collection string) string {
+	return c.Collection(collection).PrimaryKey
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Collection keys are normalized the same way collection names in requests are
+func TestLoadNormalizesCollections(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{"collections": {" Users ": {"idStrategy": "uuidv7"}, "POSTS": {"primaryKey": "slug"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cfg.Collection("users").IDStrategy; got != "uuidv7" {
+		t.Errorf("got users idStrategy %q, want uuidv7", got)
+	}
+	if got := cfg.PrimaryKey("posts"); got != "slug" {
+		t.Errorf("got posts primaryKey %q, want slug", got)
+	}
+}
+
+// Two keys that normalize to the same collection are ambiguous
+func TestLoadRejectsDuplicateCollections(t *testing.T) {
+	if _, err := Load(writeConfig(t, `{"collections": {"users": {}, "Users": {}}}`)); err == nil {
+		t.Error("got no error for a collection listed twice")
+	}
+}
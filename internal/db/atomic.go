@@ -0,0 +1,145 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrCorrupt is returned by Load when the database file can't be parsed and there was nothing to recover it from
+var ErrCorrupt = errors.New("database file is corrupt")
+
+// tempPattern is the name pattern of the temp files written next to the database file by writeFileAtomic
+func tempPattern(path string) string {
+	return filepath.Base(path) + ".tmp-*"
+}
+
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and renames it over path.
+// A crash halfway through leaves the old file untouched instead of a truncated one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, tempPattern(path))
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	// Clean up the temp file if anything below fails - After the rename there is nothing left to remove
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	renamed = true
+
+	// fsync the directory as well, otherwise the rename itself might not survive a crash
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Some platforms (Windows) can't sync a directory - That's not worth failing the write over
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// leftoverTemps returns the temp files a crashed save left behind next to path, newest first
+func leftoverTemps(path string) []string {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), tempPattern(path)))
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+
+	modTimes := make(map[string]int64, len(matches))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil {
+			modTimes[match] = info.ModTime().UnixNano()
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return modTimes[matches[i]] > modTimes[matches[j]]
+	})
+
+	return matches
+}
+
+// recoverFile decides what Load should read from path, taking leftover temp files from a crashed save into account.
+//
+//   - A valid main file wins - Leftover temp files were never committed and get removed.
+//   - A missing or corrupt main file is replaced by the newest temp file that holds valid JSON.
+//   - If nothing valid is found, a corrupt main file is reported as ErrCorrupt along with the ways to recover.
+//
+// Returns the content to load, or nil if there is no database yet.
+func recoverFile(path string) ([]byte, error) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+	missing := os.IsNotExist(readErr) || len(data) == 0
+
+	temps := leftoverTemps(path)
+
+	if !missing && json.Valid(data) {
+		for _, temp := range temps {
+			slog.Warn("Removing leftover temp file from an interrupted save", "file", temp)
+			os.Remove(temp)
+		}
+		return data, nil
+	}
+
+	for _, temp := range temps {
+		tempData, err := os.ReadFile(temp)
+		if err != nil || len(tempData) == 0 || !json.Valid(tempData) {
+			continue
+		}
+
+		slog.Warn("Recovering database from temp file left by an interrupted save", "file", temp, "database", path)
+		if err := os.Rename(temp, path); err != nil {
+			return nil, err
+		}
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+		return tempData, nil
+	}
+
+	if missing {
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s holds invalid JSON. Restore it from a backup, fix the JSON by hand, "+
+		"or delete (or empty) the file to start over with an empty database", ErrCorrupt, path)
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"slices"
+)
+
+// index maps the primary key of every entry in a collection to its position in the collection.
+// With duplicate keys the first entry wins, the same one a scan from the start would find.
+type index map[string]int
+
+// buildIndex indexes items by their keyField
+func buildIndex(items []map[string]any, keyField string) index {
+	idx := make(index, len(items))
+	for i, item := range items {
+		id := entryID(item, keyField)
+		if _, dup := idx[id]; !dup {
+			idx[id] = i
+		}
+	}
+	return idx
+}
+
+// index returns the index of a collection, building it on first use. The caller has to hold db.mu (read or write).
+// Returns nil if the collection doesn't exist.
+func (db *DB[T]) index(name string) index {
+	// Readers share db.mu, so building and storing an index needs a lock of its own
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	if idx, ok := db.indexes[name]; ok {
+		return idx
+	}
+
+	items, exists := db.Data.Collection(name)
+	if !exists {
+		return nil
+	}
+
+	if db.indexes == nil {
+		db.indexes = map[string]index{}
+	}
+	idx := buildIndex(items, db.KeyField(name))
+	db.indexes[name] = idx
+	return idx
+}
+
+// setIndex swaps in the index a transaction kept for a collection it changed. nil drops the index,
+// and the next lookup builds it again.
+func (db *DB[T]) setIndex(name string, idx index) {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	// The collection changed in ways that moved its entries around - The field indexes are rebuilt on the next lookup
+	delete(db.fieldIndexes, name)
+	delete(db.fieldNames, name)
+
+	if idx == nil {
+		delete(db.indexes, name)
+		return
+	}
+	if db.indexes == nil {
+		db.indexes = map[string]index{}
+	}
+	db.indexes[name] = idx
+}
+
+// updateIndex swaps in the index a transaction kept for a collection whose entries were only replaced in place
+// or appended. Nothing moved, so the field indexes and field names are brought up to date rather than dropped.
+// before holds the entries that were replaced, after the ones that took their place and the appended ones, by position.
+func (db *DB[T]) updateIndex(name string, idx index, before, after map[int]map[string]any) {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	if db.indexes == nil {
+		db.indexes = map[string]index{}
+	}
+	db.indexes[name] = idx
+
+	for field, fieldIdx := range db.fieldIndexes[name] {
+		for position, item := range before {
+			fieldIdx.remove(item, field, position)
+		}
+		for position, item := range after {
+			fieldIdx.add(item, field, position)
+		}
+	}
+
+	if names, ok := db.fieldNames[name]; ok {
+		for _, item := range before {
+			for key := range item {
+				names[key]--
+			}
+		}
+		for _, item := range after {
+			for key := range item {
+				names[key]++
+			}
+		}
+	}
+}
+
+// dropIndexes forgets every index - For when Data is swapped out wholesale. The caller has to hold the write lock.
+// Declared field indexes stay declared, and are rebuilt from the new data on the next lookup.
+func (db *DB[T]) dropIndexes() {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	db.indexes = nil
+	db.fieldIndexes = nil
+	db.fieldNames = nil
+}
+
+// Find returns the entry of a collection with the given primary key, without scanning or copying the collection.
+// The entry is shared with the DB - Clone it before making changes.
+func (db *DB[T]) Find(name string, id string) (map[string]any, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	position, ok := db.index(name)[id]
+	if !ok {
+		return nil, false
+	}
+
+	items, _ := db.Data.Collection(name)
+	return items[position], true
+}
+
+// Find returns the entry of a collection with the given primary key as seen by the transaction, and its index
+// (as used by Replace and Remove). Returns nil and -1 if there is no such entry.
+func (tx *Tx[T]) Find(name string, id string) (map[string]any, int) {
+	if staged, ok := tx.staged[name]; ok {
+		position, ok := staged.find(id)
+		if !ok {
+			return nil, -1
+		}
+		return staged.at(position), position
+	}
+
+	position, ok := tx.index(name)[id]
+	if !ok {
+		return nil, -1
+	}
+	items, _ := tx.data.Collection(name)
+	return items[position], position
+}
+
+// fieldIndex maps the values of a field (as strings, the way filters compare them) to the positions of the entries holding them
+type fieldIndex map[string][]int
+
+// buildFieldIndex indexes items by field. Entries without the field (or with null) are left out, they never match a filter.
+func buildFieldIndex(items []map[string]any, field string) fieldIndex {
+	idx := fieldIndex{}
+	for i, item := range items {
+		if key, ok := entryValue(item, field); ok {
+			idx[key] = append(idx[key], i)
+		}
+	}
+	return idx
+}
+
+// entryValue returns the value of an entry's field the way a fieldIndex keys it. ok is false without the field or with null.
+func entryValue(item map[string]any, field string) (key string, ok bool) {
+	if value, exists := item[field]; !exists || value == nil {
+		return "", false
+	}
+	return entryID(item, field), true
+}
+
+// add puts the position of item under its value of field, keeping the positions in order
+func (idx fieldIndex) add(item map[string]any, field string, position int) {
+	key, ok := entryValue(item, field)
+	if !ok {
+		return
+	}
+	at, _ := slices.BinarySearch(idx[key], position)
+	idx[key] = slices.Insert(idx[key], at, position)
+}
+
+// remove takes the position of item out from under its value of field
+func (idx fieldIndex) remove(item map[string]any, field string, position int) {
+	key, ok := entryValue(item, field)
+	if !ok {
+		return
+	}
+	at, found := slices.BinarySearch(idx[key], position)
+	if !found {
+		return
+	}
+	idx[key] = slices.Delete(idx[key], at, at+1)
+	if len(idx[key]) == 0 {
+		delete(idx, key)
+	}
+}
+
+// AddIndex declares a secondary index on a top level field of a collection. It's built on the first Lookup.
+// Transactions that replace or append entries keep it up to date, ones that move entries around (a remove) drop it
+// until the next Lookup.
+func (db *DB[T]) AddIndex(collection string, field string) {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	if db.indexedFields == nil {
+		db.indexedFields = map[string][]string{}
+	}
+	if !slices.Contains(db.indexedFields[collection], field) {
+		db.indexedFields[collection] = append(db.indexedFields[collection], field)
+	}
+}
+
+// Indexes returns the declared secondary indexes - Field names by collection
+func (db *DB[T]) Indexes() map[string][]string {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	indexes := make(map[string][]string, len(db.indexedFields))
+	for collection, fields := range db.indexedFields {
+		indexes[collection] = slices.Sorted(slices.Values(fields))
+	}
+	return indexes
+}
+
+// Lookup returns the entries of a collection whose field equals one of values, in collection order.
+// ok is false if there's no index on the field (or no such collection) - The caller has to scan instead.
+// The entries are shared with the DB - Clone them before making changes.
+func (db *DB[T]) Lookup(collection string, field string, values []string) (items []map[string]any, ok bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := db.fieldIndex(collection, field)
+	if idx == nil {
+		return nil, false
+	}
+
+	var positions []int
+	for _, value := range slices.Compact(slices.Sorted(slices.Values(values))) {
+		positions = append(positions, idx[value]...)
+	}
+	// Several values means several runs of positions - Back into collection order
+	if len(values) > 1 {
+		slices.Sort(positions)
+	}
+
+	all, _ := db.Data.Collection(collection)
+	items = make([]map[string]any, len(positions))
+	for i, position := range positions {
+		items[i] = all[position]
+	}
+	return items, true
+}
+
+// fieldIndex returns the secondary index on a collection's field, building it if it's declared but missing.
+// Returns nil if the field isn't indexed or the collection doesn't exist. The caller has to hold db.mu.
+func (db *DB[T]) fieldIndex(collection string, field string) fieldIndex {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	if !slices.Contains(db.indexedFields[collection], field) {
+		return nil
+	}
+	if idx, ok := db.fieldIndexes[collection][field]; ok {
+		return idx
+	}
+
+	items, exists := db.Data.Collection(collection)
+	if !exists {
+		return nil
+	}
+
+	if db.fieldIndexes == nil {
+		db.fieldIndexes = map[string]map[string]fieldIndex{}
+	}
+	if db.fieldIndexes[collection] == nil {
+		db.fieldIndexes[collection] = map[string]fieldIndex{}
+	}
+	idx := buildFieldIndex(items, field)
+	db.fieldIndexes[collection][field] = idx
+	return idx
+}
+
+// HasField reports whether any entry of a collection has the top level key field, null or not.
+// The keys are counted on the first call, and kept up to date the same way as the field indexes.
+func (db *DB[T]) HasField(collection string, field string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+
+	names, ok := db.fieldNames[collection]
+	if !ok {
+		items, _ := db.Data.Collection(collection)
+		names = map[string]int{}
+		for _, item := range items {
+			for key := range item {
+				names[key]++
+			}
+		}
+
+		if db.fieldNames == nil {
+			db.fieldNames = map[string]map[string]int{}
+		}
+		db.fieldNames[collection] = names
+	}
+
+	return names[field] > 0
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// benchSizes are the collection sizes the benchmarks run at
+var benchSizes = []int{100, 10_000, 1_000_000}
+
+// benchDB returns an in-memory DB holding a posts collection of n entries with the IDs 1 to n
+func benchDB(n int) *DB[model.Data] {
+	items := make([]map[string]any, n)
+	for i := range items {
+		items[i] = map[string]any{"id": strconv.Itoa(i + 1), "views": i}
+	}
+
+	data := model.NewData()
+	data.SetCollection("posts", items)
+	// A seed makes it a memory mode DB - Nothing is saved, so the benchmarks measure the DB itself
+	return &DB[model.Data]{Data: data, seed: []byte("{}"), primaryKey: defaultPrimaryKey}
+}
+
+// Looking an entry up through the index
+func BenchmarkFind(b *testing.B) {
+	for _, n := range benchSizes {
+		db := benchDB(n)
+		db.Find("posts", "1")
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				if _, ok := db.Find("posts", strconv.Itoa(i%n+1)); !ok {
+					b.Fatal("entry not found")
+				}
+			}
+		})
+	}
+}
+
+// Looking an entry up the way it was done without an index - Copy the collection and go through it
+func BenchmarkScan(b *testing.B) {
+	for _, n := range benchSizes {
+		db := benchDB(n)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				id := strconv.Itoa(i%n + 1)
+				items, _ := db.GetCollection("posts")
+				found := false
+				for _, item := range items {
+					if entryID(item, "id") == id {
+						found = true
+						break
+					}
+				}
+				if !found {
+					b.Fatal("entry not found")
+				}
+			}
+		})
+	}
+}
+
+func TestTxIndex(t *testing.T) {
+	db := benchDB(5)
+
+	// Changes made in a transaction that fails are never seen
+	db.Transaction(func(tx *Tx[model.Data]) error {
+		tx.Insert("posts", map[string]any{"id": "6"})
+		_, i := tx.Find("posts", "2")
+		tx.Replace("posts", i, map[string]any{"id": "20"})
+		if _, i := tx.Find("posts", "20"); i != 1 {
+			t.Errorf("replaced entry found at %d inside the transaction, want 1", i)
+		}
+		return fmt.Errorf("rolled back")
+	})
+	for id, want := range map[string]bool{"2": true, "6": false, "20": false} {
+		if _, ok := db.Find("posts", id); ok != want {
+			t.Errorf("after a rollback Find(%s) = %v, want %v", id, ok, want)
+		}
+	}
+
+	// And the ones that commit are
+	err := db.Transaction(func(tx *Tx[model.Data]) error {
+		tx.Insert("posts", map[string]any{"id": "6"})
+		_, i := tx.Find("posts", "3")
+		tx.Replace("posts", i, map[string]any{"id": "3", "views": 30})
+		_, i = tx.Find("posts", "1")
+		tx.Remove("posts", i)
+		// Positions shifted - Everything after the removed entry moved up one
+		if _, i := tx.Find("posts", "6"); i != 4 {
+			t.Errorf("inserted entry found at %d after a remove, want 4", i)
+		}
+		tx.Insert("posts", map[string]any{"id": "7"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ := db.GetCollection("posts")
+	for position, item := range items {
+		id := entryID(item, "id")
+		if found, ok := db.Find("posts", id); !ok || entryID(found, "id") != id {
+			t.Errorf("Find(%s) = %v, %v", id, found, ok)
+		}
+		if _, i := findInTx(db, id); i != position {
+			t.Errorf("entry %s found at %d, want %d", id, i, position)
+		}
+	}
+	if got, _ := db.Find("posts", "3"); got["views"] != 30 {
+		t.Errorf("got %v, want the replaced entry", got)
+	}
+	if len(items) != 6 {
+		t.Errorf("got %d entries, want 6", len(items))
+	}
+}
+
+// Remove updates the DB's index in place - It has to hold up with duplicate keys and transactions that fail
+func TestTxRemoveIndex(t *testing.T) {
+	db := benchDB(5)
+
+	db.Transaction(func(tx *Tx[model.Data]) error {
+		tx.Insert("posts", map[string]any{"id": "6"})
+		_, i := tx.Find("posts", "2")
+		tx.Remove("posts", i)
+		return fmt.Errorf("rolled back")
+	})
+	for id, want := range map[string]int{"1": 0, "2": 1, "5": 4, "6": -1} {
+		if _, i := findInTx(db, id); i != want {
+			t.Errorf("after a rollback entry %s found at %d, want %d", id, i, want)
+		}
+	}
+
+	// Two more entries with the key 3 - Removing the first hands the index to the next
+	err := db.Transaction(func(tx *Tx[model.Data]) error {
+		tx.Insert("posts", map[string]any{"id": "3", "views": 30})
+		tx.Insert("posts", map[string]any{"id": "3", "views": 31})
+		tx.RemoveMany("posts", []int{0, 2, 5})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ := db.GetCollection("posts")
+	if len(items) != 4 {
+		t.Fatalf("got %v, want 4 entries", items)
+	}
+	for id, want := range map[string]int{"1": -1, "2": 0, "3": 3, "4": 1, "5": 2} {
+		if _, i := findInTx(db, id); i != want {
+			t.Errorf("entry %s found at %d, want %d", id, i, want)
+		}
+	}
+	if got, _ := db.Find("posts", "3"); got["views"] != 31 {
+		t.Errorf("got %v, want the last entry with the key 3", got)
+	}
+}
+
+// Replacing and appending keeps the field indexes (and field names) up to date, removing drops them
+func TestFieldIndexAfterWrites(t *testing.T) {
+	db := benchDB(5)
+	db.AddIndex("posts", "views")
+	db.Lookup("posts", "views", []string{"1"})
+	db.HasField("posts", "views")
+
+	lookup := func(value string) []string {
+		items, _ := db.Lookup("posts", "views", []string{value})
+		result := []string{}
+		for _, item := range items {
+			result = append(result, entryID(item, "id"))
+		}
+		return result
+	}
+
+	err := db.Transaction(func(tx *Tx[model.Data]) error {
+		_, i := tx.Find("posts", "4")
+		tx.Replace("posts", i, map[string]any{"id": "4", "views": 1, "draft": true})
+		tx.Insert("posts", map[string]any{"id": "6", "views": 1})
+		_, i = tx.Find("posts", "2")
+		tx.Replace("posts", i, map[string]any{"id": "2"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.fieldIndexes["posts"]["views"]; !ok {
+		t.Error("field index was dropped by a transaction that only replaced and appended")
+	}
+	if got := lookup("1"); !slices.Equal(got, []string{"4", "6"}) {
+		t.Errorf("views=1 got %v, want [4 6]", got)
+	}
+	if got := lookup("3"); len(got) != 0 {
+		t.Errorf("views=3 got %v, want none", got)
+	}
+	if !db.HasField("posts", "draft") {
+		t.Error("HasField misses a key added by a replace")
+	}
+
+	// Dropping the last entry with a key forgets it
+	db.Transaction(func(tx *Tx[model.Data]) error {
+		_, i := tx.Find("posts", "4")
+		tx.Replace("posts", i, map[string]any{"id": "4", "views": 3})
+		return nil
+	})
+	if db.HasField("posts", "draft") {
+		t.Error("HasField still reports a key no entry has")
+	}
+
+	// A remove moves the entries after it - The index is rebuilt
+	db.Transaction(func(tx *Tx[model.Data]) error {
+		_, i := tx.Find("posts", "1")
+		tx.Remove("posts", i)
+		return nil
+	})
+	if got := lookup("3"); !slices.Equal(got, []string{"4"}) {
+		t.Errorf("views=3 after a remove got %v, want [4]", got)
+	}
+}
+
+// findInTx looks an entry up from a transaction of its own
+func findInTx(db *DB[model.Data], id string) (map[string]any, int) {
+	var item map[string]any
+	position := -1
+	db.Transaction(func(tx *Tx[model.Data]) error {
+		item, position = tx.Find("posts", id)
+		return nil
+	})
+	return item, position
+}
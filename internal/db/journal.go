@@ -0,0 +1,447 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultCompactThreshold is the journal size that triggers a compaction when Options doesn't set one
+const DefaultCompactThreshold = 8 << 20 // 8 MiB
+
+// journal is an append-only NDJSON log of the Ops committed since the last snapshot (the main database file).
+// Every transaction becomes one or more lines, and the last line of a transaction is marked with "end",
+// so a transaction that was only half written when the process died is skipped on replay.
+// The first line names the snapshot the journal was started on ({"base":"<sha256>"}).
+type journal struct {
+	path       string
+	file       *os.File
+	size       int64
+	threshold  int64
+	compacting bool
+}
+
+// journalLine is the on-disk shape of a single Op
+type journalLine struct {
+	Op
+	End bool `json:"end,omitempty"`
+}
+
+// replayLine is journalLine with the payload kept raw until we know which op it belongs to
+type replayLine struct {
+	Collection string          `json:"collection"`
+	Op         string          `json:"op"`
+	ID         string          `json:"id"`
+	Nth        int             `json:"nth"`
+	Payload    json.RawMessage `json:"payload"`
+	End        bool            `json:"end"`
+	Base       string          `json:"base"` // only on the header line
+}
+
+// snapshotHash identifies the content of a snapshot in a journal header
+func snapshotHash(snapshot []byte) string {
+	sum := sha256.Sum256(snapshot)
+	return hex.EncodeToString(sum[:])
+}
+
+// journalHeader is the first line of a journal started on the snapshot with the given hash
+func journalHeader(base string) []byte {
+	return []byte(`{"base":"` + base + `"}` + "\n")
+}
+
+// journalBase returns the snapshot hash from the header of a journal, "" for a journal without one
+func journalBase(content []byte) string {
+	first, _, _ := bytes.Cut(content, []byte("\n"))
+	var line replayLine
+	if err := json.Unmarshal(first, &line); err != nil {
+		return ""
+	}
+	return line.Base
+}
+
+// journalPath returns where the journal for the database at path lives (data/db.json -> data/db.journal.ndjson)
+func journalPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".journal.ndjson"
+}
+
+// compactingPath is where the journal is moved while a compaction writes the new snapshot
+func compactingPath(path string) string {
+	return path + ".compacting"
+}
+
+// openJournal replays the journal (and a journal left over from an interrupted compaction) onto data,
+// then opens it for appending. snapshot is the content of the database file data was loaded from.
+func openJournal[T Store](path string, threshold int64, snapshot []byte, data T, keyField func(string) string) (*journal, error) {
+	if threshold <= 0 {
+		threshold = DefaultCompactThreshold
+	}
+	j := &journal{path: path, threshold: threshold}
+	base := snapshotHash(snapshot)
+
+	// An interrupted compaction leaves its journal behind - Those ops come before the ones in the current journal
+	combined := journalHeader(base)
+	for _, file := range []string{compactingPath(path), path} {
+		content, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The compaction got as far as writing the new snapshot - Its ops are in there already
+		if file == compactingPath(path) {
+			if fileBase := journalBase(content); fileBase != "" && fileBase != base {
+				slog.Info("Skipping the journal of a compaction that already wrote its snapshot", "file", file)
+				continue
+			}
+		}
+
+		valid, err := replay(content, data, keyField)
+		if err != nil {
+			return nil, fmt.Errorf("%w: journal %s - %v", ErrCorrupt, file, err)
+		}
+		if valid < len(content) {
+			slog.Warn("Dropping an incomplete transaction at the end of the journal", "file", file, "bytes", len(content)-valid)
+		}
+		// The combined journal gets a header of its own
+		content = content[:valid]
+		for journalBase(content) != "" {
+			_, content, _ = bytes.Cut(content, []byte("\n"))
+		}
+		combined = append(combined, content...)
+	}
+
+	// Rewrite the journal as a single file without torn tails, so new lines are appended after a complete one
+	if err := writeFileAtomic(path, combined, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(compactingPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := j.open(""); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// open opens the journal file for appending. A new, empty journal gets a header naming the snapshot base.
+func (j *journal) open(base string) error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	j.file = file
+	j.size = info.Size()
+
+	if j.size == 0 && base != "" {
+		header := journalHeader(base)
+		if _, err := j.file.Write(header); err != nil {
+			return err
+		}
+		j.size = int64(len(header))
+	}
+	return nil
+}
+
+// append writes the ops of one transaction to the journal and fsyncs it
+func (j *journal) append(ops []Op) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i, op := range ops {
+		if err := encoder.Encode(journalLine{Op: op, End: i == len(ops)-1}); err != nil {
+			return err
+		}
+	}
+
+	// The transaction fails as a whole if it can't be written and synced completely. Whatever made it into the file
+	// is cut off again - Left there, it would be replayed (or, as a torn line, break every append after it).
+	start := j.size
+	_, err := j.file.Write(buf.Bytes())
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		if truncErr := j.file.Truncate(start); truncErr != nil {
+			return errors.Join(err, truncErr)
+		}
+		return err
+	}
+
+	j.size += int64(buf.Len())
+	return nil
+}
+
+// needsCompaction reports whether the journal has grown past its threshold and no compaction is running yet
+func (j *journal) needsCompaction() bool {
+	return !j.compacting && j.size >= j.threshold
+}
+
+// rotate moves the current journal aside for a compaction and starts a new, empty one on the snapshot
+func (j *journal) rotate(snapshot []byte) error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(j.path, compactingPath(j.path)); err != nil {
+		// Keep appending to the journal we have
+		if openErr := j.open(""); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return j.open(snapshotHash(snapshot))
+}
+
+// unrotate puts the journal moved aside by rotate back in front of the current one, after a failed compaction
+func (j *journal) unrotate() error {
+	previous, err := os.ReadFile(compactingPath(j.path))
+	if err != nil {
+		return err
+	}
+	current, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(j.path, append(previous, current...), 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(compactingPath(j.path)); err != nil {
+		return err
+	}
+	return j.open("")
+}
+
+// close closes the journal file
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+// replay applies the complete transactions in content to data.
+// Returns how many bytes of content hold complete transactions - Anything after that is a torn write.
+func replay[T Store](content []byte, data T, keyField func(string) string) (int, error) {
+	reader := bufio.NewReader(bytes.NewReader(content))
+	state := newReplayState(data, keyField)
+
+	var pending []replayLine
+	offset, valid := 0, 0
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) == 0 && err == io.EOF {
+			break
+		}
+		offset += len(raw)
+
+		var line replayLine
+		if jsonErr := json.Unmarshal(raw, &line); jsonErr != nil || err == io.EOF {
+			// A line without a newline, or one that doesn't parse, is only acceptable as the torn end of the file
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				break
+			}
+			return 0, fmt.Errorf("invalid line at byte %d", offset-len(raw))
+		}
+
+		// Headers only matter to openJournal - Two journals joined by unrotate have one in the middle as well
+		if line.Base != "" && len(pending) == 0 {
+			valid = offset
+			continue
+		}
+
+		pending = append(pending, line)
+		if !line.End {
+			continue
+		}
+
+		for _, op := range pending {
+			if err := state.apply(op); err != nil {
+				return 0, err
+			}
+		}
+		pending = pending[:0]
+		valid = offset
+	}
+
+	state.finish()
+	return valid, nil
+}
+
+// replayState holds the collections a replay has touched so far, with the positions of every primary key in them,
+// so an op is a map lookup rather than a scan of the collection. Deleted entries are left as nil until finish.
+type replayState[T Store] struct {
+	data      T
+	keyField  func(collection string) string
+	items     map[string][]map[string]any
+	positions map[string]map[string][]int
+}
+
+func newReplayState[T Store](data T, keyField func(string) string) *replayState[T] {
+	return &replayState[T]{data: data, keyField: keyField, items: map[string][]map[string]any{}, positions: map[string]map[string][]int{}}
+}
+
+// buildPositions maps every primary key in items to the positions holding it, in order - Keys can repeat
+func buildPositions(items []map[string]any, keyField string) map[string][]int {
+	positions := make(map[string][]int, len(items))
+	for i, item := range items {
+		id := entryID(item, keyField)
+		positions[id] = append(positions[id], i)
+	}
+	return positions
+}
+
+// collection returns the working copy of a collection and its positions, starting from data the first time
+func (r *replayState[T]) collection(name string) ([]map[string]any, map[string][]int) {
+	if items, ok := r.items[name]; ok {
+		return items, r.positions[name]
+	}
+
+	items, _ := r.data.Collection(name)
+	items = slices.Clone(items)
+	r.items[name] = items
+	r.positions[name] = buildPositions(items, r.keyField(name))
+	return items, r.positions[name]
+}
+
+// apply applies a single journal line. Inserts append, the same as they did when they were made - Duplicate keys
+// included. Replaces and deletes name the entry by its key and which of the entries with that key it is (nth).
+func (r *replayState[T]) apply(line replayLine) error {
+	if line.Op == OpSetResource {
+		item := map[string]any{}
+		if err := json.Unmarshal(line.Payload, &item); err != nil {
+			return err
+		}
+		// Storing a resource replaces a collection of the same name
+		delete(r.items, line.Collection)
+		delete(r.positions, line.Collection)
+		r.data.SetResource(line.Collection, item)
+		return nil
+	}
+
+	items, positions := r.collection(line.Collection)
+
+	switch line.Op {
+	case OpInsert:
+		var item map[string]any
+		if err := json.Unmarshal(line.Payload, &item); err != nil {
+			return err
+		}
+		positions[line.ID] = append(positions[line.ID], len(items))
+		r.items[line.Collection] = append(items, item)
+	case OpReplace:
+		var item map[string]any
+		if err := json.Unmarshal(line.Payload, &item); err != nil {
+			return err
+		}
+		position, err := target(positions, line)
+		if err != nil {
+			return err
+		}
+		items[position] = item
+
+		// A new key moves the position over to it
+		if id := entryID(item, r.keyField(line.Collection)); id != line.ID {
+			positions[line.ID] = slices.DeleteFunc(positions[line.ID], func(p int) bool { return p == position })
+			at, _ := slices.BinarySearch(positions[id], position)
+			positions[id] = slices.Insert(positions[id], at, position)
+		}
+	case OpDelete:
+		position, err := target(positions, line)
+		if err != nil {
+			return err
+		}
+		items[position] = nil
+		positions[line.ID] = slices.DeleteFunc(positions[line.ID], func(p int) bool { return p == position })
+	case OpSet:
+		items = []map[string]any{}
+		if err := json.Unmarshal(line.Payload, &items); err != nil {
+			return err
+		}
+		r.items[line.Collection] = items
+		r.positions[line.Collection] = buildPositions(items, r.keyField(line.Collection))
+	default:
+		return fmt.Errorf("unknown journal op %q", line.Op)
+	}
+
+	return nil
+}
+
+// target returns the position of the entry a replace or delete line is about
+func target(positions map[string][]int, line replayLine) (int, error) {
+	list := positions[line.ID]
+	if line.Nth >= len(list) {
+		return 0, fmt.Errorf("%s on %s/%s: no such entry", line.Op, line.Collection, line.ID)
+	}
+	return list[line.Nth], nil
+}
+
+// finish drops the deleted entries and stores the touched collections in data
+func (r *replayState[T]) finish() {
+	for name, items := range r.items {
+		kept := slices.DeleteFunc(items, func(item map[string]any) bool { return item == nil })
+		if kept == nil {
+			kept = []map[string]any{}
+		}
+		r.data.SetCollection(name, kept)
+	}
+}
+
+// compact folds the journal into a new snapshot of the database file and starts over with an empty journal.
+// Only the marshalling and the journal swap happen under the lock - The snapshot is written outside of it.
+func (db *DB[T]) compact() {
+	defer db.compactions.Done()
+
+	db.mu.Lock()
+	jsonData, err := json.MarshalIndent(db.Data, "", "  ")
+	if err == nil {
+		db.markWritten(jsonData)
+		err = db.journal.rotate(jsonData)
+	}
+	if err != nil {
+		db.journal.compacting = false
+		db.mu.Unlock()
+		slog.Error("Journal compaction failed", "error", err)
+		return
+	}
+	db.mu.Unlock()
+
+	err = writeFileAtomic(db.Path, jsonData, 0644)
+	if err == nil {
+		// The snapshot is in place - A journal left behind now is skipped on the next start, its header names the old one
+		if removeErr := os.Remove(compactingPath(db.journal.path)); removeErr != nil {
+			slog.Warn("Could not remove the compacted journal", "error", removeErr)
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.journal.compacting = false
+
+	if err != nil {
+		slog.Error("Journal compaction failed", "error", err)
+		if restoreErr := db.journal.unrotate(); restoreErr != nil {
+			slog.Error("Could not restore the journal after a failed compaction", "error", restoreErr)
+		}
+		return
+	}
+
+	slog.Info("Journal compacted", "database", db.Path)
+}
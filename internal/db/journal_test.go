@@ -0,0 +1,151 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// Every kind of op survives a restart, in the order it was made
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := os.WriteFile(path, []byte(`{"posts":[{"id":"1","v":0},{"id":"2","v":0},{"id":"3","v":0}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := LoadWithOptions[model.Data](path, Options{Journal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []func(tx *Tx[model.Data]){
+		func(tx *Tx[model.Data]) { tx.Insert("posts", map[string]any{"id": "4", "v": 0}) },
+		func(tx *Tx[model.Data]) {
+			_, i := tx.Find("posts", "2")
+			tx.Replace("posts", i, map[string]any{"id": "2", "v": 1})
+		},
+		func(tx *Tx[model.Data]) { _, i := tx.Find("posts", "1"); tx.Remove("posts", i) },
+		// Positions shifted - The replay has to find 3 where it is now
+		func(tx *Tx[model.Data]) {
+			_, i := tx.Find("posts", "3")
+			tx.Replace("posts", i, map[string]any{"id": "3", "v": 2})
+		},
+		func(tx *Tx[model.Data]) { tx.Insert("posts", map[string]any{"id": "1", "v": 3}) },
+		// Duplicate keys are allowed - Every insert stays, and replace and delete hit the entry they were made on
+		func(tx *Tx[model.Data]) { tx.Insert("posts", map[string]any{"id": "4", "v": 5}) },
+		func(tx *Tx[model.Data]) { tx.Insert("posts", map[string]any{"id": "4", "v": 6}) },
+		func(tx *Tx[model.Data]) { tx.Replace("posts", 4, map[string]any{"id": "4", "v": 7}) },
+		func(tx *Tx[model.Data]) { tx.Remove("posts", 2) },
+		func(tx *Tx[model.Data]) {
+			tx.Insert("posts", map[string]any{"id": "6", "v": 8})
+			tx.Insert("posts", map[string]any{"id": "6", "v": 9})
+			tx.Insert("posts", map[string]any{"id": "6", "v": 10})
+		},
+		func(tx *Tx[model.Data]) { tx.RemoveMany("posts", []int{5, 7}) },
+		func(tx *Tx[model.Data]) { tx.UpdateCollection("tags", []map[string]any{{"id": "a"}}) },
+		func(tx *Tx[model.Data]) { _, i := tx.Find("tags", "a"); tx.Remove("tags", i) },
+		func(tx *Tx[model.Data]) { tx.SetResource("profile", map[string]any{"name": "ole"}) },
+	}
+	for _, step := range steps {
+		if err := db.Transaction(func(tx *Tx[model.Data]) error { step(tx); return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transaction torn in half by a crash is dropped
+	journal, err := os.OpenFile(journalPath(path), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.WriteString(`{"collection":"posts","op":"insert","id":"9","payload":{"id":"9"}}` + "\n" + `{"collection":"po`)
+	journal.Close()
+
+	reloaded, err := LoadWithOptions[model.Data](path, Options{Journal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	posts, _ := reloaded.GetCollection("posts")
+	want := []string{"2:1", "3:2", "1:3", "4:7", "4:6", "6:9"}
+	if len(posts) != len(want) {
+		t.Fatalf("got %v, want ids %v", posts, want)
+	}
+	for i, post := range posts {
+		if got := entryID(post, "id") + ":" + entryID(post, "v"); got != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, got, want[i])
+		}
+	}
+
+	if tags, ok := reloaded.GetCollection("tags"); !ok || len(tags) != 0 {
+		t.Errorf("got tags %v, want an empty collection", tags)
+	}
+	if profile, ok := reloaded.GetResource("profile"); !ok || profile["name"] != "ole" {
+		t.Errorf("got profile %v", profile)
+	}
+
+	// New appends land after the complete transactions, and replay fine on the next start
+	if err := reloaded.Transaction(func(tx *Tx[model.Data]) error {
+		tx.Insert("posts", map[string]any{"id": "5"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Close()
+	if _, err := LoadWithOptions[model.Data](path, Options{Journal: true}); err != nil {
+		t.Fatalf("journal doesn't load after appending past a torn tail: %v", err)
+	}
+}
+
+// The journal of a compaction is replayed only if the compaction didn't get as far as writing the snapshot
+func TestJournalCompactingLeftover(t *testing.T) {
+	snapshot := []byte(`{"posts":[{"id":"1"},{"id":"2"}]}`)
+	insert := `{"collection":"posts","op":"insert","id":"2","payload":{"id":"2"},"end":true}` + "\n"
+
+	tests := []struct {
+		name string
+		base string
+		want int
+	}{
+		{"snapshot not written", snapshotHash(snapshot), 3},
+		{"snapshot written", snapshotHash([]byte(`{"posts":[{"id":"1"}]}`)), 2},
+		{"journal without a header", "", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db.json")
+			if err := os.WriteFile(path, snapshot, 0644); err != nil {
+				t.Fatal(err)
+			}
+			content := insert
+			if tt.base != "" {
+				content = string(journalHeader(tt.base)) + insert
+			}
+			if err := os.WriteFile(compactingPath(journalPath(path)), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := LoadWithOptions[model.Data](path, Options{Journal: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if posts, _ := db.GetCollection("posts"); len(posts) != tt.want {
+				t.Errorf("got %v, want %d entries", posts, tt.want)
+			}
+
+			// The journals are joined under a single header
+			journal, _ := os.ReadFile(journalPath(path))
+			if n := strings.Count(string(journal), `"base"`); n != 1 {
+				t.Errorf("journal has %d headers, want 1:\n%s", n, journal)
+			}
+		})
+	}
+}
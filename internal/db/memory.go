@@ -0,0 +1,48 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNotInMemory is returned by Reset when the DB isn't running in memory mode
+var ErrNotInMemory = errors.New("reset is only available in memory mode")
+
+// loadSeed reads the seed file for memory mode. A missing seed file is fine - We just start out empty.
+// Nothing is created on disk, the seed is only ever read.
+func loadSeed(path string) ([]byte, error) {
+	seed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(seed) == 0) {
+		return []byte("{}"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(seed) {
+		return nil, fmt.Errorf("%w: seed file %s holds invalid JSON", ErrCorrupt, path)
+	}
+
+	return seed, nil
+}
+
+// Reset throws away every change made since the server started and goes back to the data from the seed file
+func (db *DB[T]) Reset() error {
+	if db.seed == nil {
+		return ErrNotInMemory
+	}
+
+	var fresh T
+	if err := json.Unmarshal(db.seed, &fresh); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Data = fresh
+	db.generation++
+	db.dropIndexes()
+
+	return nil
+}
@@ -1,21 +1,112 @@
 package db
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
-type DB[T any] struct {
+// Store is what the DB needs from the data it holds - Named collections of entries, and singular resources
+type Store interface {
+	Collection(name string) ([]map[string]any, bool)
+	SetCollection(name string, items []map[string]any)
+	DeleteCollection(name string)
+
+	Resource(name string) (map[string]any, bool)
+	SetResource(name string, item map[string]any)
+	DeleteResource(name string)
+}
+
+type DB[T Store] struct {
 	Path string
 	mu sync.RWMutex
 	Data T
+
+	journal     *journal // nil unless running in journal mode
+	compactions sync.WaitGroup
+
+	writeBehind *writeBehind // nil unless running in write-behind mode
+
+	watcher *watcher          // nil unless watching the file for outside changes
+	written [][sha256.Size]byte // hashes of the last few contents the DB wrote itself, newest last
+
+	seed []byte // the content Path held on load - nil unless running in memory mode
+
+	primaryKey func(collection string) string
+	generation uint64 // bumped every time Data is replaced wholesale (reset, reload)
+
+	indexes       map[string]index                 // primary key -> position, by collection. Built on first lookup
+	indexedFields map[string][]string              // fields with a declared secondary index, by collection
+	fieldIndexes  map[string]map[string]fieldIndex // the secondary indexes built so far, by collection and field
+	fieldNames    map[string]map[string]int        // how many entries use each top level key, by collection - Built by HasField
+	indexMu       sync.Mutex
 }
 
-func Load[T any](file string) (*DB[T], error){
-	// Check if the file exists
-	path := filepath.Join("data", file + ".json")
+// Options tweaks how the DB persists its data. The zero value rewrites the whole file on every write.
+type Options struct {
+	// Journal appends every change to an NDJSON journal next to the database file instead of rewriting the file.
+	// The journal is replayed on load and folded back into the database file once it grows past CompactThreshold.
+	Journal bool
+	// CompactThreshold is the journal size in bytes that triggers a compaction. Defaults to DefaultCompactThreshold.
+	CompactThreshold int64
+
+	// WriteBehind only marks the DB as dirty on a write, and leaves saving to a background goroutine.
+	// It saves every FlushInterval, or as soon as FlushAfter changes are pending, and once more on Close.
+	// Changes made since the last flush are lost if the process dies without calling Close.
+	WriteBehind   bool
+	FlushInterval time.Duration // Defaults to DefaultFlushInterval
+	FlushAfter    int           // Defaults to DefaultFlushAfter
+
+	// Watch polls the database file and reloads it when it's edited by someone else while the server runs.
+	Watch         bool
+	WatchInterval time.Duration // Defaults to DefaultWatchInterval
+
+	// PrimaryKey returns the field entries of a collection are identified by. Defaults to "id" everywhere.
+	// Used to match journal entries to the entries they change.
+	PrimaryKey func(collection string) string
+
+	// Memory keeps every change in memory only. The database file is read once as a seed and never written,
+	// so every run starts from the same data - Reset goes back to it without a restart.
+	Memory bool
+}
+
+// ErrConflictingOptions is returned by LoadWithOptions when asked for modes that don't work together
+var ErrConflictingOptions = errors.New("conflicting storage options")
+
+// DefaultPath is where the database lives unless told otherwise
+var DefaultPath = filepath.Join("data", "db.json")
+
+// Load reads the database file at path with the default options
+func Load[T Store](path string) (*DB[T], error) {
+	return LoadWithOptions[T](path, Options{})
+}
+
+// LoadWithOptions reads the database file at path, creating it (and any missing directories) if it doesn't exist
+func LoadWithOptions[T Store](path string, opts Options) (*DB[T], error){
+	if opts.Journal && opts.WriteBehind {
+		return nil, fmt.Errorf("%w: journal and write-behind mode can't be combined", ErrConflictingOptions)
+	}
+	// The database file is only a snapshot in journal mode - Editing it by hand would fight the journal
+	if opts.Journal && opts.Watch {
+		return nil, fmt.Errorf("%w: journal mode can't be combined with watching the file", ErrConflictingOptions)
+	}
+	if opts.Memory && (opts.Journal || opts.WriteBehind || opts.Watch) {
+		return nil, fmt.Errorf("%w: memory mode never writes or reloads the file", ErrConflictingOptions)
+	}
+
+	if opts.PrimaryKey == nil {
+		opts.PrimaryKey = defaultPrimaryKey
+	}
+
+	if opts.Memory {
+		return loadMemory[T](path, opts.PrimaryKey)
+	}
 
 	// making sure the directory exists
 	// 0755 for owner r/w/e, group r/e, others r/e
@@ -23,25 +114,96 @@ func Load[T any](file string) (*DB[T], error){
 		return nil, err
 	}
 
-	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) || len(data) == 0 {
-		// If not - Create it with a default value
+	// Picks up leftovers from a save that crashed halfway, and refuses to start on a corrupt file
+	data, err := recoverFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		// No database yet - Create it with a default value
 		data = []byte("{}")
-		if writeErr := os.WriteFile(path, data, 0644); writeErr != nil {
+		if writeErr := writeFileAtomic(path, data, 0644); writeErr != nil {
 			return nil, writeErr
 		}
-	} else if err != nil {
-		return nil, err
 	}
 
 	// Unmarshal JSON into db.Data
 	var dbData  T
 	if err := json.Unmarshal(data, &dbData); err != nil {
+		// Valid JSON, but not the shape of T (an array at the top level etc)
+		return nil, fmt.Errorf("%w: %s - %v", ErrCorrupt, path, err)
+	}
+
+	db := &DB[T]{Path: path, Data: dbData, primaryKey: opts.PrimaryKey}
+
+	// The snapshot alone isn't the whole story in journal mode - Replay what happened since
+	if opts.Journal {
+		j, err := openJournal(journalPath(path), opts.CompactThreshold, data, db.Data, db.KeyField)
+		if err != nil {
+			return nil, err
+		}
+		db.journal = j
+	}
+
+	if opts.WriteBehind {
+		db.writeBehind = newWriteBehind(opts.FlushInterval, opts.FlushAfter)
+		go db.runFlusher()
+	}
+
+	if opts.Watch {
+		db.watcher = newWatcher(path, opts.WatchInterval)
+		go db.runWatcher()
+	}
+
+	return db, nil
+}
+
+// loadMemory sets up a DB that starts from the seed file at path and never saves
+func loadMemory[T Store](path string, primaryKey func(string) string) (*DB[T], error) {
+	seed, err := loadSeed(path)
+	if err != nil {
 		return nil, err
 	}
 
-	// Return &DB{Path: path, Data: data}
-	return &DB[T]{Path: path, Data: dbData}, nil
+	var dbData T
+	if err := json.Unmarshal(seed, &dbData); err != nil {
+		return nil, fmt.Errorf("%w: seed file %s - %v", ErrCorrupt, path, err)
+	}
+
+	return &DB[T]{Path: path, Data: dbData, seed: seed, primaryKey: primaryKey}, nil
+}
+
+// defaultPrimaryKey is used when Options doesn't say - Every collection is keyed by "id"
+func defaultPrimaryKey(string) string {
+	return "id"
+}
+
+// KeyField returns the primary key field of a collection
+func (db *DB[T]) KeyField(collection string) string {
+	return db.primaryKey(collection)
+}
+
+// Close flushes anything still pending and releases the files held by the DB.
+// Should be called on shutdown - In write-behind mode it's what saves the last changes.
+func (db *DB[T]) Close() error {
+	if db.watcher != nil {
+		db.stopWatcher()
+	}
+
+	if db.writeBehind != nil {
+		return db.stopFlusher()
+	}
+
+	// Let a running compaction finish, it still needs the journal
+	db.compactions.Wait()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.journal == nil {
+		return nil
+	}
+	return db.journal.close()
 }
 
 func (db *DB[T]) save() error {
@@ -50,9 +212,38 @@ func (db *DB[T]) save() error {
 	if err != nil {
 		return err
 	}
-	// write to db.Path
+	db.markWritten(jsonData)
+	// write to db.Path through a temp file, so a crash mid-write can't truncate it
 	// Return error or nil
-	return os.WriteFile(db.Path, jsonData, 0644)
+	return writeFileAtomic(db.Path, jsonData, 0644)
+}
+
+// commit persists the ops of a transaction whose changes have already been applied to db.Data
+func (db *DB[T]) commit(ops []Op) error {
+	// Memory mode - The changes are already applied, and that's all there is to it
+	if db.seed != nil {
+		return nil
+	}
+
+	if db.writeBehind != nil {
+		db.writeBehind.markDirty(len(ops))
+		return nil
+	}
+
+	if db.journal == nil {
+		return db.save()
+	}
+
+	if err := db.journal.append(ops); err != nil {
+		return err
+	}
+
+	if db.journal.needsCompaction() {
+		db.journal.compacting = true
+		db.compactions.Add(1)
+		go db.compact()
+	}
+	return nil
 }
 
 // GetCollection returns a copy of the data avilable in the DB
@@ -60,12 +251,7 @@ func (db *DB[T]) GetCollection(name string) ([]map[string]any, bool) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	data, ok := any(db.Data).(map[string][]map[string]any)
-	if !ok {
-		 	return nil, false
-	}
-
-	original, exists := data[name]
+	original, exists := db.Data.Collection(name)
 	if !exists {
 		return nil, false
 	}
@@ -76,16 +262,23 @@ func (db *DB[T]) GetCollection(name string) ([]map[string]any, bool) {
 	return copyItems, true
 }
 
-func (db *DB[T]) UpdateCollection(name string, items []map[string]any) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// GetResource returns a copy of a singular resource in the DB
+func (db *DB[T]) GetResource(name string) (map[string]any, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 
-	data, ok := any(db.Data).(map[string][]map[string]any)
-	if !ok {
-		return os.ErrInvalid
+	item, exists := db.Data.Resource(name)
+	if !exists {
+		return nil, false
 	}
 
-	data[name] = items
+	return maps.Clone(item), true
+}
 
-	return db.save()
+// UpdateCollection replaces a single collection and saves - A transaction with just the one change
+func (db *DB[T]) UpdateCollection(name string, items []map[string]any) error {
+	return db.Transaction(func(tx *Tx[T]) error {
+		tx.UpdateCollection(name, items)
+		return nil
+	})
 }
\ No newline at end of file
@@ -0,0 +1,486 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Tx stages changes to collections while a transaction is running.
+// Nothing touches the DB's data until the transaction callback has returned without an error.
+type Tx[T Store] struct {
+	data       T
+	staged     map[string]*stagedCollection
+	resources  map[string]map[string]any
+	ops        []Op
+	keyField   func(collection string) string
+	generation uint64
+
+	index func(collection string) index // the DB's index of a collection
+}
+
+// stagedCollection is a collection with the changes of a transaction.
+// While the changes only replace and append entries it's an overlay on the DB's entries and index, which are
+// left as they are until the commit - A write costs the same however large the collection is.
+// Changes that shift entries around (Remove, a new primary key, UpdateCollection) give it a copy of its own.
+// Remove keeps the DB's index and updates it in place, rebuilding it would cost more than the copy.
+type stagedCollection struct {
+	items []map[string]any // the DB's entries while shared, the transaction's own once not
+	index index            // the DB's index while shared, changed in place or the transaction's own once not
+
+	indexChanged bool // the DB's index was changed in place - It has to go if the transaction doesn't commit
+
+	shared   bool
+	replaced map[int]map[string]any // entries of items swapped out while shared, by position
+	appended []map[string]any       // entries inserted while shared, after items
+	added    index                  // positions of the keys inserted while shared
+}
+
+// ownCollection returns a staged collection that's the transaction's own, indexed by keyField
+func ownCollection(items []map[string]any, keyField string) *stagedCollection {
+	return &stagedCollection{items: items, index: buildIndex(items, keyField)}
+}
+
+// len returns the number of entries, including the ones appended
+func (c *stagedCollection) len() int {
+	return len(c.items) + len(c.appended)
+}
+
+// at returns the entry at position
+func (c *stagedCollection) at(position int) map[string]any {
+	if position >= len(c.items) {
+		return c.appended[position-len(c.items)]
+	}
+	if item, ok := c.replaced[position]; ok {
+		return item
+	}
+	return c.items[position]
+}
+
+// find returns the position of the entry with the primary key id
+func (c *stagedCollection) find(id string) (int, bool) {
+	if position, ok := c.added[id]; ok {
+		return position, true
+	}
+	position, ok := c.index[id]
+	return position, ok
+}
+
+// all returns the entries with the changes applied, as a new slice
+func (c *stagedCollection) all() []map[string]any {
+	items := make([]map[string]any, 0, c.len())
+	items = append(items, c.items...)
+	for position, item := range c.replaced {
+		items[position] = item
+	}
+	return append(items, c.appended...)
+}
+
+// insert appends item, which has the primary key id. With duplicate keys the first entry keeps the index.
+func (c *stagedCollection) insert(item map[string]any, id string) {
+	_, dup := c.find(id)
+	if !c.shared {
+		c.items = append(c.items, item)
+		if !dup {
+			c.index[id] = len(c.items) - 1
+		}
+		return
+	}
+
+	c.appended = append(c.appended, item)
+	if !dup {
+		c.added[id] = c.len() - 1
+	}
+}
+
+// replace swaps the entry at position for item, which has the same primary key
+func (c *stagedCollection) replace(position int, item map[string]any) {
+	switch {
+	case !c.shared:
+		c.items[position] = item
+	case position >= len(c.items):
+		c.appended[position-len(c.items)] = item
+	default:
+		c.replaced[position] = item
+	}
+}
+
+// changed returns the entries replaced or appended while shared, by position
+func (c *stagedCollection) changed() map[int]map[string]any {
+	changed := maps.Clone(c.replaced)
+	for i, item := range c.appended {
+		changed[len(c.items)+i] = item
+	}
+	return changed
+}
+
+// occurrence returns which of the entries with the primary key id the one at position is, counting from 0
+func (c *stagedCollection) occurrence(position int, id, keyField string) int {
+	first, ok := c.find(id)
+	if !ok || first >= position {
+		return 0
+	}
+
+	// Only duplicate keys get this far
+	n := 0
+	for p := first; p < position; p++ {
+		if entryID(c.at(p), keyField) == id {
+			n++
+		}
+	}
+	return n
+}
+
+// own gives the collection a copy of the entries of its own. The DB's index comes along, with the keys inserted
+// so far added to it.
+func (c *stagedCollection) own() {
+	if c.shared {
+		maps.Copy(c.index, c.added)
+		*c = stagedCollection{items: c.all(), index: c.index, indexChanged: len(c.added) > 0}
+	}
+}
+
+// remove deletes the entries at positions (sorted, no repeats) from a collection the transaction owns.
+// ids are their primary keys. The index is updated in place - Keys that lost their entry are deleted, and the
+// positions after a removed entry move up.
+func (c *stagedCollection) remove(positions []int, ids []string, keyField string) {
+	// Fewer keys than entries means some keys are on more than one entry
+	duplicates := len(c.index) < len(c.items)
+
+	kept := c.items[:0]
+	next := 0
+	for i, item := range c.items {
+		if next < len(positions) && positions[next] == i {
+			next++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	clear(c.items[len(kept):])
+	c.items = kept
+
+	c.indexChanged = true
+	lost := map[string]bool{}
+	for i, position := range positions {
+		if c.index[ids[i]] == position {
+			delete(c.index, ids[i])
+			lost[ids[i]] = true
+		}
+	}
+	for id, position := range c.index {
+		if shift, _ := slices.BinarySearch(positions, position); shift > 0 {
+			c.index[id] = position - shift
+		}
+	}
+
+	// A removed entry had the index for its key - Another entry with the same key takes over
+	if !duplicates {
+		return
+	}
+	for position, item := range c.items {
+		if len(lost) == 0 {
+			break
+		}
+		if id := entryID(item, keyField); lost[id] {
+			c.index[id] = position
+			delete(lost, id)
+		}
+	}
+}
+
+// reindex rebuilds the index of a collection the transaction owns - For changes that shift positions around
+func (c *stagedCollection) reindex(keyField string) {
+	c.index = buildIndex(c.items, keyField)
+}
+
+// Op is a single change made within a transaction. In journal mode every Op becomes one line in the journal.
+type Op struct {
+	Collection string `json:"collection"`
+	Op         string `json:"op"`
+	ID         string `json:"id,omitempty"`
+	Nth        int    `json:"nth,omitempty"` // which of the entries with the ID a replace or delete is about
+	Payload    any    `json:"payload,omitempty"`
+}
+
+// The kinds of Op a transaction can record
+const (
+	OpInsert      = "insert"   // append an entry (payload) to the collection
+	OpReplace     = "replace"  // swap out the nth entry with the ID for payload
+	OpDelete      = "delete"   // remove the nth entry with the ID
+	OpSet         = "set"      // replace the whole collection (payload)
+	OpSetResource = "resource" // replace a singular resource (payload)
+)
+
+// GetCollection returns a copy of a collection as seen by the transaction,
+// including any changes staged earlier in the same transaction.
+func (tx *Tx[T]) GetCollection(name string) ([]map[string]any, bool) {
+	if staged, ok := tx.staged[name]; ok {
+		return staged.all(), true
+	}
+
+	original, exists := tx.data.Collection(name)
+	if !exists {
+		return nil, false
+	}
+
+	copyItems := make([]map[string]any, len(original))
+	copy(copyItems, original)
+
+	return copyItems, true
+}
+
+// GetResource returns a copy of a singular resource as seen by the transaction
+func (tx *Tx[T]) GetResource(name string) (map[string]any, bool) {
+	item, exists := tx.resources[name]
+	if !exists {
+		item, exists = tx.data.Resource(name)
+	}
+	if !exists {
+		return nil, false
+	}
+
+	return maps.Clone(item), true
+}
+
+// HasCollection reports whether a collection exists as seen by the transaction, without copying it
+func (tx *Tx[T]) HasCollection(name string) bool {
+	if _, exists := tx.staged[name]; exists {
+		return true
+	}
+	_, exists := tx.data.Collection(name)
+	return exists
+}
+
+// SetResource stages item as the new content of a singular resource. Creates the resource on commit if it's missing.
+func (tx *Tx[T]) SetResource(name string, item map[string]any) {
+	tx.resources[name] = item
+	tx.ops = append(tx.ops, Op{Collection: name, Op: OpSetResource, Payload: item})
+}
+
+// UpdateCollection stages items as the new content of a collection. Creates the collection on commit if it's missing.
+func (tx *Tx[T]) UpdateCollection(name string, items []map[string]any) {
+	tx.staged[name] = ownCollection(items, tx.keyField(name))
+	tx.ops = append(tx.ops, Op{Collection: name, Op: OpSet, Payload: items})
+}
+
+// Insert appends item to a collection. Creates the collection on commit if it's missing.
+func (tx *Tx[T]) Insert(name string, item map[string]any) {
+	id := tx.entryID(name, item)
+	tx.stage(name).insert(item, id)
+	tx.ops = append(tx.ops, Op{Collection: name, Op: OpInsert, ID: id, Payload: item})
+}
+
+// Replace swaps the entry at index (as returned by GetCollection) for item
+func (tx *Tx[T]) Replace(name string, index int, item map[string]any) {
+	staged := tx.stage(name)
+	previous := tx.entryID(name, staged.at(index))
+	op := Op{Collection: name, Op: OpReplace, ID: previous, Nth: staged.occurrence(index, previous, tx.keyField(name)), Payload: item}
+	staged.replace(index, item)
+
+	// Same key, same position - The index only needs a rebuild when the key changes
+	id := tx.entryID(name, item)
+	if id != previous {
+		staged.own()
+		staged.reindex(tx.keyField(name))
+	}
+	tx.ops = append(tx.ops, op)
+}
+
+// Remove deletes the entry at index (as returned by GetCollection)
+func (tx *Tx[T]) Remove(name string, index int) {
+	staged := tx.stage(name)
+	id := tx.entryID(name, staged.at(index))
+	tx.ops = append(tx.ops, Op{Collection: name, Op: OpDelete, ID: id, Nth: staged.occurrence(index, id, tx.keyField(name))})
+
+	// Everything after the entry moves up one - Not something an overlay can keep track of
+	staged.own()
+	staged.remove([]int{index}, []string{id}, tx.keyField(name))
+}
+
+// RemoveMany deletes the entries at the given indexes (as returned by GetCollection) in a single pass
+func (tx *Tx[T]) RemoveMany(name string, indexes []int) {
+	if len(indexes) == 0 {
+		return
+	}
+
+	indexes = slices.Clone(indexes)
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	// The ops are replayed one after the other - An entry removed earlier no longer counts towards nth
+	staged := tx.stage(name)
+	ids := make([]string, len(indexes))
+	removed := map[string]int{}
+	for i, index := range indexes {
+		ids[i] = tx.entryID(name, staged.at(index))
+		tx.ops = append(tx.ops, Op{Collection: name, Op: OpDelete, ID: ids[i], Nth: staged.occurrence(index, ids[i], tx.keyField(name)) - removed[ids[i]]})
+		removed[ids[i]]++
+	}
+
+	staged.own()
+	staged.remove(indexes, ids, tx.keyField(name))
+}
+
+// stage returns the staged version of a collection. The first time it's an overlay on the DB's entries and index,
+// nothing is copied. A collection that doesn't exist yet starts out empty.
+func (tx *Tx[T]) stage(name string) *stagedCollection {
+	if staged, ok := tx.staged[name]; ok {
+		return staged
+	}
+
+	staged := &stagedCollection{index: index{}}
+	if items, exists := tx.data.Collection(name); exists {
+		staged = &stagedCollection{items: items, index: tx.index(name), shared: true, replaced: map[int]map[string]any{}, added: index{}}
+	}
+	tx.staged[name] = staged
+	return staged
+}
+
+// entryID returns the primary key of an entry the same way the service layer compares them
+func (tx *Tx[T]) entryID(collection string, item map[string]any) string {
+	return entryID(item, tx.keyField(collection))
+}
+
+// entryID returns the value of an entry's primary key field as a string
+func entryID(item map[string]any, keyField string) string {
+	return fmt.Sprint(item[keyField])
+}
+
+// KeyField returns the primary key field of a collection
+func (tx *Tx[T]) KeyField(collection string) string {
+	return tx.keyField(collection)
+}
+
+// Generation changes whenever the DB's data is swapped out wholesale (a reset or a reload from disk).
+// Anything cached about the data from an older generation is stale.
+func (tx *Tx[T]) Generation() uint64 {
+	return tx.generation
+}
+
+// snapshot holds what a name pointed to before a commit, so a failed save can put it back.
+// Both kinds are kept, since storing one kind under a name replaces the other.
+type snapshot struct {
+	items       []map[string]any
+	hasItems    bool
+	resource    map[string]any
+	hasResource bool
+
+	overwritten map[int]map[string]any // entries of items that were replaced in place, by position
+}
+
+// apply writes the staged changes into the data and returns what was there before
+func (tx *Tx[T]) apply() map[string]snapshot {
+	previous := make(map[string]snapshot, len(tx.staged)+len(tx.resources))
+	remember := func(name string) {
+		if _, ok := previous[name]; ok {
+			return
+		}
+		items, hasItems := tx.data.Collection(name)
+		resource, hasResource := tx.data.Resource(name)
+		previous[name] = snapshot{items: items, hasItems: hasItems, resource: resource, hasResource: hasResource}
+	}
+
+	for name, staged := range tx.staged {
+		remember(name)
+
+		items := staged.items
+		if staged.shared {
+			// The changes go straight into the DB's entries - The ones replaced are kept for a rollback
+			snap := previous[name]
+			snap.overwritten = make(map[int]map[string]any, len(staged.replaced))
+			for position, item := range staged.replaced {
+				snap.overwritten[position] = items[position]
+				items[position] = item
+			}
+			previous[name] = snap
+			items = append(items, staged.appended...)
+		}
+		if items == nil {
+			// Inserting into a collection that didn't exist - store it as [] rather than null
+			items = []map[string]any{}
+		}
+		tx.data.SetCollection(name, items)
+	}
+
+	for name, item := range tx.resources {
+		remember(name)
+		tx.data.SetResource(name, item)
+	}
+
+	return previous
+}
+
+// rollback restores the collections and resources captured by apply
+func (tx *Tx[T]) rollback(previous map[string]snapshot) {
+	for name, snap := range previous {
+		tx.data.DeleteCollection(name)
+		tx.data.DeleteResource(name)
+
+		if snap.hasItems {
+			for position, item := range snap.overwritten {
+				snap.items[position] = item
+			}
+			tx.data.SetCollection(name, snap.items)
+		}
+		if snap.hasResource {
+			tx.data.SetResource(name, snap.resource)
+		}
+	}
+}
+
+// Transaction runs fn while holding the write lock, so no other reader or writer can get in between.
+// If fn returns an error the staged changes are dropped. Otherwise they are applied and saved as one unit,
+// and rolled back again if the save fails.
+func (db *DB[T]) Transaction(fn func(tx *Tx[T]) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := &Tx[T]{
+		data:       db.Data,
+		staged:     map[string]*stagedCollection{},
+		resources:  map[string]map[string]any{},
+		keyField:   db.KeyField,
+		generation: db.generation,
+		index:      db.index,
+	}
+	if err := fn(tx); err != nil {
+		// The DB's entries are as they were, an index changed in place isn't - It's rebuilt on the next lookup
+		for name, staged := range tx.staged {
+			if staged.indexChanged {
+				db.setIndex(name, nil)
+			}
+		}
+		return err
+	}
+
+	// Nothing to write
+	if len(tx.staged) == 0 && len(tx.resources) == 0 {
+		return nil
+	}
+
+	previous := tx.apply()
+	if err := db.commit(tx.ops); err != nil {
+		tx.rollback(previous)
+		// The old indexes are rebuilt on the next lookup
+		for name := range previous {
+			db.setIndex(name, nil)
+		}
+		return err
+	}
+
+	// The staged collections come with their indexes, resources don't have any.
+	// An overlay's keys go into the DB's index as it is - Nothing can be looking at it while the write lock is held.
+	for name, staged := range tx.staged {
+		maps.Copy(staged.index, staged.added)
+		if !staged.shared {
+			db.setIndex(name, staged.index)
+			continue
+		}
+		db.updateIndex(name, staged.index, previous[name].overwritten, staged.changed())
+	}
+	for name := range tx.resources {
+		db.setIndex(name, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// Replacing a single entry - The cost shouldn't grow with the collection
+func BenchmarkTxReplace(b *testing.B) {
+	for _, n := range benchSizes {
+		db := benchDB(n)
+		db.Find("posts", "1")
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				id := strconv.Itoa(i%n + 1)
+				db.Transaction(func(tx *Tx[model.Data]) error {
+					_, index := tx.Find("posts", id)
+					tx.Replace("posts", index, map[string]any{"id": id, "views": i})
+					return nil
+				})
+			}
+		})
+	}
+}
+
+// Removing a single entry - It's put back at the end in the same transaction, so the collection keeps its size
+func BenchmarkTxRemove(b *testing.B) {
+	for _, n := range benchSizes {
+		db := benchDB(n)
+		db.Find("posts", "1")
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				id := strconv.Itoa(i%n + 1)
+				db.Transaction(func(tx *Tx[model.Data]) error {
+					item, index := tx.Find("posts", id)
+					tx.Remove("posts", index)
+					tx.Insert("posts", item)
+					return nil
+				})
+			}
+		})
+	}
+}
+
+// Appending a single entry
+func BenchmarkTxInsert(b *testing.B) {
+	for _, n := range benchSizes {
+		db := benchDB(n)
+		db.Find("posts", "1")
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				db.Transaction(func(tx *Tx[model.Data]) error {
+					tx.Insert("posts", map[string]any{"id": fmt.Sprint("new", i)})
+					return nil
+				})
+			}
+		})
+	}
+}
+
+// A commit writes replaced entries straight into the DB's collection - A failed save has to put them back
+func TestTxRollbackAfterFailedSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "db.json")
+	if err := os.WriteFile(path, []byte(`{"posts":[{"id":"1","v":0},{"id":"2","v":0}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Load[model.Data](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nowhere to save to
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Transaction(func(tx *Tx[model.Data]) error {
+		_, i := tx.Find("posts", "2")
+		tx.Replace("posts", i, map[string]any{"id": "2", "v": 1})
+		tx.Insert("posts", map[string]any{"id": "3"})
+		return nil
+	})
+	if err == nil {
+		t.Fatal("save didn't fail")
+	}
+
+	items, _ := db.GetCollection("posts")
+	if len(items) != 2 {
+		t.Errorf("got %d entries, want 2", len(items))
+	}
+	if item, _ := db.Find("posts", "2"); entryID(item, "v") != "0" {
+		t.Errorf("got %v, want the entry from before the transaction", item)
+	}
+	if _, ok := db.Find("posts", "3"); ok {
+		t.Error("entry of the failed transaction is still there")
+	}
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// DefaultWatchInterval is how often the database file is checked for changes when Options doesn't say
+const DefaultWatchInterval = time.Second
+
+// recentWrites is how many of its own saves the DB remembers. The file on disk can lag behind the latest save
+// (a write-behind flush writes outside the lock), so any of the recent ones can show up on a check.
+const recentWrites = 16
+
+// watcher polls the database file and reloads it when someone else changes it.
+// Polling mtime + size and then comparing hashes keeps it to the standard library.
+type watcher struct {
+	interval time.Duration
+
+	// What the file looked like the last time we checked
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWatcher(path string, interval time.Duration) *watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	w := &watcher{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// Start from the file as it is right now, so the first tick doesn't reload what Load just read
+	if info, err := os.Stat(path); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+	if content, err := os.ReadFile(path); err == nil {
+		w.hash = sha256.Sum256(content)
+	}
+
+	return w
+}
+
+// markWritten remembers the content the DB itself is about to write to db.Path, so the watcher can ignore it.
+// Must be called while holding the DB's write lock.
+func (db *DB[T]) markWritten(content []byte) {
+	db.rememberWrite(sha256.Sum256(content))
+}
+
+// rememberWrite adds hash to the recent saves, forgetting the oldest once there are more than recentWrites
+func (db *DB[T]) rememberWrite(hash [sha256.Size]byte) {
+	db.written = append(db.written, hash)
+	if len(db.written) > recentWrites {
+		db.written = slices.Delete(db.written, 0, len(db.written)-recentWrites)
+	}
+}
+
+// runWatcher checks the database file every interval until Close stops it
+func (db *DB[T]) runWatcher() {
+	w := db.watcher
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			db.checkForChanges()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// checkForChanges reloads the database file if it changed on disk since the last check,
+// unless the change is one the DB wrote itself or the new content doesn't parse.
+func (db *DB[T]) checkForChanges() {
+	w := db.watcher
+
+	info, err := os.Stat(db.Path)
+	if err != nil {
+		// Most likely caught in the middle of a rename - Try again next tick
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	content, err := os.ReadFile(db.Path)
+	if err != nil {
+		return
+	}
+	if sha256.Sum256(content) == w.hash {
+		// Touched, but the content is the same
+		return
+	}
+
+	// Read it again under the lock - A save can land between the read above and here, and the older content
+	// must not be taken for an outside edit. No save can happen while we decide.
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	content, err = os.ReadFile(db.Path)
+	if err != nil {
+		return
+	}
+	hash := sha256.Sum256(content)
+	w.hash = hash
+
+	if slices.Contains(db.written, hash) {
+		// One of our own saves - Possibly not the latest one, in write-behind mode
+		return
+	}
+
+	// A broken edit shouldn't cost us the data we have
+	var fresh T
+	if err := json.Unmarshal(content, &fresh); err != nil {
+		slog.Error("Ignoring change to the database file - Keeping the data in memory", "file", db.Path, "error", err)
+		return
+	}
+
+	if db.writeBehind != nil && db.writeBehind.pending > 0 {
+		slog.Warn("Database file changed on disk - Discarding changes that weren't saved yet", "file", db.Path, "pending", db.writeBehind.pending)
+		db.writeBehind.pending = 0
+	}
+
+	db.Data = fresh
+	db.generation++
+	db.dropIndexes()
+	db.rememberWrite(hash)
+	slog.Info("Reloaded database after it changed on disk", "file", db.Path)
+}
+
+// stopWatcher stops the watcher goroutine
+func (db *DB[T]) stopWatcher() {
+	close(db.watcher.stop)
+	<-db.watcher.done
+}
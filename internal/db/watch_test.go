@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// The watcher must never mistake one of the DB's own saves for an outside edit - Not even an older one that's
+// still on disk when the check runs. Reloading it would throw away writes that were already acknowledged.
+func TestWatchIgnoresOwnSaves(t *testing.T) {
+	for name, opts := range map[string]Options{
+		// Checking as often as the ticker allows, to hit the window between a save and the check
+		"write-through": {Watch: true, WatchInterval: time.Microsecond},
+		"write-behind":  {Watch: true, WatchInterval: time.Microsecond, WriteBehind: true, FlushInterval: time.Millisecond, FlushAfter: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db.json")
+			db, err := LoadWithOptions[model.Data](path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const writes = 300
+			var wg sync.WaitGroup
+			for i := range writes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := db.Transaction(func(tx *Tx[model.Data]) error {
+						tx.Insert("posts", map[string]any{"id": fmt.Sprint(i)})
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if db.generation != 0 {
+				t.Errorf("watcher reloaded the DB's own saves %d times", db.generation)
+			}
+			items, _ := db.GetCollection("posts")
+			if len(items) != writes {
+				t.Errorf("got %d entries in memory, want %d", len(items), writes)
+			}
+
+			// And everything made it to disk
+			reloaded, err := Load[model.Data](path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items, _ = reloaded.GetCollection("posts")
+			if len(items) != writes {
+				t.Errorf("got %d entries on disk, want %d", len(items), writes)
+			}
+		})
+	}
+}
+
+// An edit made by someone else is still picked up
+func TestWatchReloadsOutsideEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := LoadWithOptions[model.Data](path, Options{Watch: true, WatchInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.WriteFile(path, []byte(`{"posts":[{"id":"1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// mtime granularity can hide the edit - Make sure it looks different
+	db.watcher.size = -1
+	db.checkForChanges()
+
+	if _, ok := db.Find("posts", "1"); !ok {
+		t.Error("outside edit wasn't reloaded")
+	}
+}
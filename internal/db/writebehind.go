@@ -0,0 +1,116 @@
+package db
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// Defaults for write-behind mode when Options doesn't set them
+const (
+	DefaultFlushInterval = time.Second
+	DefaultFlushAfter    = 100
+)
+
+// writeBehind keeps track of changes that are applied in memory but not yet saved to disk
+type writeBehind struct {
+	interval time.Duration
+	after    int
+	pending  int // changes since the last flush - Guarded by the DB's lock
+
+	wake chan struct{} // nudges the flusher once pending reaches after
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWriteBehind(interval time.Duration, after int) *writeBehind {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	if after <= 0 {
+		after = DefaultFlushAfter
+	}
+
+	return &writeBehind{
+		interval: interval,
+		after:    after,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// markDirty records a committed transaction, and wakes the flusher if enough of them have piled up.
+// Must be called while holding the DB's write lock.
+func (wb *writeBehind) markDirty(changes int) {
+	wb.pending += changes
+	if wb.pending >= wb.after {
+		select {
+		case wb.wake <- struct{}{}:
+		default: // a flush is already on its way
+		}
+	}
+}
+
+// runFlusher saves the DB every interval, or sooner when woken, until Close stops it
+func (db *DB[T]) runFlusher() {
+	wb := db.writeBehind
+	defer close(wb.done)
+
+	ticker := time.NewTicker(wb.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-wb.wake:
+		case <-wb.stop:
+			return
+		}
+
+		if err := db.flush(); err != nil {
+			slog.Error("Write-behind flush failed", "error", err)
+		}
+	}
+}
+
+// flush writes the DB to disk if anything changed since the last flush.
+// Only the marshalling happens under the lock - Requests can keep going while the file is written.
+func (db *DB[T]) flush() error {
+	wb := db.writeBehind
+
+	db.mu.Lock()
+	changes := wb.pending
+	if changes == 0 {
+		db.mu.Unlock()
+		return nil
+	}
+	jsonData, err := json.MarshalIndent(db.Data, "", "  ")
+	if err == nil {
+		wb.pending = 0
+		db.markWritten(jsonData)
+	}
+	db.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(db.Path, jsonData, 0644); err != nil {
+		// Try again on the next round
+		db.mu.Lock()
+		wb.pending += changes
+		db.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// stopFlusher stops the background flusher and writes whatever is still pending
+func (db *DB[T]) stopFlusher() error {
+	close(db.writeBehind.stop)
+	<-db.writeBehind.done
+
+	return db.flush()
+}
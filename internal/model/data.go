@@ -1,4 +1,106 @@
 package model
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
 // dynamic data collection
-type Data map[string][]map[string]any
\ No newline at end of file
+// Top level arrays in db.json are collections, top level objects are singular resources (profile, settings etc).
+// A name is only ever one of the two.
+type Data struct {
+	Collections map[string][]map[string]any
+	Resources   map[string]map[string]any
+}
+
+// NewData returns empty Data, ready to use
+func NewData() Data {
+	return Data{
+		Collections: map[string][]map[string]any{},
+		Resources:   map[string]map[string]any{},
+	}
+}
+
+// Collection returns the collection stored under name and whether it exists
+func (d Data) Collection(name string) ([]map[string]any, bool) {
+	items, ok := d.Collections[name]
+	return items, ok
+}
+
+// SetCollection stores items under name, creating the collection if it's missing
+func (d Data) SetCollection(name string, items []map[string]any) {
+	delete(d.Resources, name)
+	d.Collections[name] = items
+}
+
+// DeleteCollection removes the collection stored under name
+func (d Data) DeleteCollection(name string) {
+	delete(d.Collections, name)
+}
+
+// Resource returns the singular resource stored under name and whether it exists
+func (d Data) Resource(name string) (map[string]any, bool) {
+	item, ok := d.Resources[name]
+	return item, ok
+}
+
+// SetResource stores item as the singular resource under name
+func (d Data) SetResource(name string, item map[string]any) {
+	delete(d.Collections, name)
+	d.Resources[name] = item
+}
+
+// DeleteResource removes the singular resource stored under name
+func (d Data) DeleteResource(name string) {
+	delete(d.Resources, name)
+}
+
+// MarshalJSON writes collections and resources side by side, the same shape as db.json
+func (d Data) MarshalJSON() ([]byte, error) {
+	merged := make(map[string]any, len(d.Collections)+len(d.Resources))
+	for name, items := range d.Collections {
+		merged[name] = items
+	}
+	for name, item := range d.Resources {
+		merged[name] = item
+	}
+
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON sorts the top level values of db.json into collections (arrays of objects) and resources (objects)
+func (d *Data) UnmarshalJSON(data []byte) error {
+	*d = NewData()
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for name, value := range raw {
+		value = bytes.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+
+		switch value[0] {
+		case '[':
+			items := []map[string]any{}
+			if err := json.Unmarshal(value, &items); err != nil {
+				return fmt.Errorf("%q: collections must be arrays of objects - %w", name, err)
+			}
+			d.Collections[name] = items
+		case '{':
+			item := map[string]any{}
+			if err := json.Unmarshal(value, &item); err != nil {
+				return fmt.Errorf("%q: %w", name, err)
+			}
+			d.Resources[name] = item
+		default:
+			return fmt.Errorf("%q: top level values must be an array (collection) or an object (singular resource)", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+var (
+	ErrBulkFailed = errors.New("One or more operations failed - Nothing was applied")
+	ErrUnknownOp  = errors.New("Unknown operation - Expected create, update or delete")
+	ErrMissingID  = errors.New("Operation needs an id")
+	ErrNotApplied = errors.New("Not applied - Another operation failed")
+)
+
+// The operations a bulk request can hold
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// BulkOp is a single operation in a bulk request
+type BulkOp struct {
+	Op   string         `json:"op"`
+	ID   any            `json:"id,omitempty"`   // update and delete
+	Data map[string]any `json:"data,omitempty"` // create and update
+}
+
+// BulkResult is the outcome of a single BulkOp. Err is nil when the operation went through,
+// and ErrNotApplied when it was fine by itself but rolled back along with a failing one.
+type BulkResult struct {
+	Op   string
+	ID   string
+	Item map[string]any
+	Err  error
+}
+
+// POST /:name/_bulk -> Applies a list of create/update/delete operations to a collection in a single write.
+// It's all or nothing - If any operation fails, none of them are applied and ErrBulkFailed is returned
+// along with the results, so the caller can see which ones failed and why.
+func (s *Service) Bulk(collection string, ops []BulkOp) ([]BulkResult, error) {
+	collection = normalizeInput(collection)
+
+	results := make([]BulkResult, len(ops))
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		counters := s.saveCounters()
+		failed := false
+		for i, op := range ops {
+			results[i] = s.applyBulkOp(tx, collection, op)
+			if results[i].Err != nil {
+				failed = true
+			}
+		}
+
+		// Returning an error drops everything staged above - The IDs the creates took are handed back as well
+		if failed {
+			s.restoreCounters(counters)
+			return ErrBulkFailed
+		}
+		return nil
+	})
+
+	if errors.Is(err, ErrBulkFailed) {
+		notApplied(results, ops)
+	}
+	return results, err
+}
+
+// notApplied marks the operations that went through by themselves as rolled back.
+// Their data and generated IDs never made it into the collection, so they aren't reported.
+func notApplied(results []BulkResult, ops []BulkOp) {
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].Err = ErrNotApplied
+		results[i].Item = nil
+		if ops[i].ID == nil {
+			results[i].ID = ""
+		}
+	}
+}
+
+// applyBulkOp runs a single operation within the bulk transaction.
+// Later operations see the changes of earlier ones - You can create an entry and update it in the same request.
+func (s *Service) applyBulkOp(tx *db.Tx[model.Data], collection string, op BulkOp) BulkResult {
+	result := BulkResult{Op: op.Op}
+	if op.ID != nil {
+		result.ID = fmt.Sprint(op.ID)
+	}
+
+	switch op.Op {
+	case BulkCreate:
+		// Copy, so a rolled back operation doesn't leave an ID behind in the caller's data
+		item := maps.Clone(op.Data)
+		if item == nil {
+			item = map[string]any{}
+		}
+		key := tx.KeyField(collection)
+		if op.ID != nil {
+			item[key] = result.ID
+		}
+		result.Err = s.insert(tx, collection, item)
+		result.Item = item
+		result.ID = fmt.Sprint(item[key])
+	case BulkUpdate:
+		if op.ID == nil {
+			result.Err = ErrMissingID
+			break
+		}
+		result.Item, result.Err = s.update(tx, collection, result.ID, op.Data, "")
+	case BulkDelete:
+		if op.ID == nil {
+			result.Err = ErrMissingID
+			break
+		}
+		result.Err = s.remove(tx, collection, result.ID, "")
+	default:
+		result.Err = fmt.Errorf("%w: %q", ErrUnknownOp, op.Op)
+	}
+
+	if result.Err != nil {
+		result.Item = nil
+	}
+	return result
+}
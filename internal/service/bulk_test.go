@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// A rolled back bulk request reports the operations that were fine as not applied, and hands their IDs back
+func TestBulkRollback(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.Create("posts", map[string]any{"title": "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Bulk("posts", []BulkOp{
+		{Op: BulkCreate, Data: map[string]any{"title": "generated"}},
+		{Op: BulkCreate, ID: "7", Data: map[string]any{"title": "supplied"}},
+		{Op: BulkUpdate, ID: "1", Data: map[string]any{"title": "updated"}},
+		{Op: BulkDelete, ID: "missing"},
+	})
+	if !errors.Is(err, ErrBulkFailed) {
+		t.Fatalf("got %v, want ErrBulkFailed", err)
+	}
+
+	want := []struct {
+		id  string
+		err error
+	}{
+		{"", ErrNotApplied},
+		{"7", ErrNotApplied},
+		{"1", ErrNotApplied},
+		{"missing", ErrEntryNotFound},
+	}
+	for i, result := range results {
+		if !errors.Is(result.Err, want[i].err) {
+			t.Errorf("result %d has error %v, want %v", i, result.Err, want[i].err)
+		}
+		if result.ID != want[i].id {
+			t.Errorf("result %d has id %q, want %q", i, result.ID, want[i].id)
+		}
+		if result.Item != nil {
+			t.Errorf("result %d has data %v for an operation that wasn't applied", i, result.Item)
+		}
+	}
+
+	if item := s.GetByID("posts", "1", nil); item["title"] != "first" {
+		t.Errorf("rolled back update went through: %v", item)
+	}
+
+	// The ID the rolled back create took is handed out again
+	item, err := s.Create("posts", map[string]any{"title": "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item["id"] != "2" {
+		t.Errorf("got id %v, want 2", item["id"])
+	}
+}
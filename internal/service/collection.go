@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+var (
+	ErrInvalidBody = errors.New("Invalid body")
+)
+
+// PUT /:name -> Replaces (or creates) an entire collection at once
+// Every entry has to be an object. Entries without an ID get one, and IDs have to be unique.
+func (s *Service) ReplaceCollection(collection string, entries []any) ([]map[string]any, error) {
+	collection = normalizeInput(collection)
+
+	primaryKey := s.DB.KeyField(collection)
+	items := make([]map[string]any, 0, len(entries))
+	seen := map[string]bool{}
+	for i, entry := range entries {
+		item, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: entry %d is not an object", ErrInvalidBody, i)
+		}
+		item = maps.Clone(item)
+
+		if id, ok := item[primaryKey]; ok {
+			key := fmt.Sprint(id)
+			if seen[key] {
+				return nil, fmt.Errorf("%w: duplicate id %q", ErrInvalidBody, key)
+			}
+			seen[key] = true
+		}
+		items = append(items, item)
+	}
+
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		// A name is either a collection or a resource - Never both
+		if _, isResource := tx.GetResource(collection); isResource {
+			return ErrIsResource
+		}
+
+		// IDs are generated after the ones supplied are counted, so they can't collide
+		for _, item := range items {
+			if id, ok := item[primaryKey]; ok {
+				s.observeID(tx, collection, id)
+			}
+		}
+		for _, item := range items {
+			if _, ok := item[primaryKey]; !ok {
+				item[primaryKey] = s.nextID(tx, collection)
+			}
+		}
+
+		tx.UpdateCollection(collection, items)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// PATCH /:name -> Updates every entry in a collection that matches the filters (all of them without filters)
+// Returns the updated entries.
+func (s *Service) UpdateCollection(collection string, filters map[string]string, fields map[string]any) ([]map[string]any, error) {
+	collection = normalizeInput(collection)
+
+	compiled, err := compileFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := []map[string]any{}
+	err = s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		items, exists := tx.GetCollection(collection)
+		if !exists {
+			return ErrCollectionNotFound
+		}
+
+		primaryKey := tx.KeyField(collection)
+		for _, index := range matchingIndexes(items, compiled) {
+			itemCopy := maps.Clone(items[index])
+			for key, value := range fields {
+				// IDs stay put, same as a PATCH on a single entry
+				if key == primaryKey {
+					continue
+				}
+				itemCopy[key] = value
+			}
+
+			tx.Replace(collection, index, itemCopy)
+			updated = append(updated, itemCopy)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DELETE /:name -> Deletes every entry in a collection that matches the filters, in a single write.
+// Without filters every entry goes - The handler makes sure that was really the intention.
+// Returns how many entries were removed, in the same shape as Delete.
+func (s *Service) DeleteWhere(collection string, filters map[string]string) (map[string]int, error) {
+	collection = normalizeInput(collection)
+
+	compiled, err := compileFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := map[string]int{}
+	err = s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		items, exists := tx.GetCollection(collection)
+		if !exists {
+			return ErrCollectionNotFound
+		}
+
+		indexes := matchingIndexes(items, compiled)
+		tx.RemoveMany(collection, indexes)
+		removed[collection] = len(indexes)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
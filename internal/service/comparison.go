@@ -3,16 +3,24 @@ package service
 import (
 	"fmt"
 	"log/slog"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 type Comparator func(itemVal any, filterVal string) bool
 
+// Matcher is a filter with its value already parsed - Reports whether a single item value passes it.
+// itemVal is nil when the item doesn't have the field.
+type Matcher func(itemVal any) bool
+
 var Comparisons = map[string]Comparator { 
 	"eq": func(iv any, fv string) bool {	// equal
 		return fmt.Sprint(iv) == fv
 	},
+	"ieq": func(iv any, fv string) bool { // equal, ignoring case
+		return strings.EqualFold(fmt.Sprint(iv), fv)
+	},
 	"ne": func(iv any, fv string) bool { // Not equal
 		return fmt.Sprint(iv) != fv
 	},
@@ -52,6 +60,19 @@ var Comparisons = map[string]Comparator {
 
 		return inputNum < filterNum
 	},
+	// The operators below parse their filter value - Compile does it once per request, these do it on every call
+	"in":     compiledComparator("in"),
+	"nin":    compiledComparator("nin"),
+	"regex":  compiledComparator("regex"),
+	"exists": compiledComparator("exists"),
+}
+
+// compiledComparator turns one of the compilers into a Comparator. A filter value the compiler can't use matches nothing.
+func compiledComparator(op string) Comparator {
+	return func(iv any, fv string) bool {
+		match, err := compilers[op](fv)
+		return err == nil && match(iv)
+	}
 }
 
 // Function to extract the comparison operation from the Comparisons map. 
@@ -75,6 +96,64 @@ func GetComparator(op string) Comparator {
 	}
 }
 
+// compilers build the Matcher for operators whose filter value takes some parsing (a list, a regex, a bool),
+// so it's parsed once per request instead of once per item. An unusable filter value is an ErrInvalidFilter.
+var compilers = map[string]func(filterVal string) (Matcher, error){
+	"in": func(fv string) (Matcher, error) {
+		set := listSet(fv)
+		return func(iv any) bool {
+			return iv != nil && set[fmt.Sprint(iv)]
+		}, nil
+	},
+	"nin": func(fv string) (Matcher, error) {
+		set := listSet(fv)
+		return func(iv any) bool {
+			return iv != nil && !set[fmt.Sprint(iv)]
+		}, nil
+	},
+	"regex": func(fv string) (Matcher, error) {
+		re, err := regexp.Compile(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a valid regex - %v", ErrInvalidFilter, fv, err)
+		}
+		return func(iv any) bool {
+			return iv != nil && re.MatchString(fmt.Sprint(iv))
+		}, nil
+	},
+	"exists": func(fv string) (Matcher, error) {
+		want, err := strconv.ParseBool(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: _exists takes true or false, not %q", ErrInvalidFilter, fv)
+		}
+		// null counts as missing
+		return func(iv any) bool {
+			return (iv != nil) == want
+		}, nil
+	},
+}
+
+// Compile returns the Matcher for an operator and a filter value
+func Compile(op string, filterVal string) (Matcher, error) {
+	if compile, ok := compilers[op]; ok {
+		return compile(filterVal)
+	}
+
+	// The plain comparators never match an item without the field
+	comparator := GetComparator(op)
+	return func(iv any) bool {
+		return iv != nil && comparator(iv, filterVal)
+	}, nil
+}
+
+// listSet turns the value of an _in/_nin filter (a,b,c) into a set
+func listSet(filterVal string) map[string]bool {
+	set := map[string]bool{}
+	for _, value := range splitList(filterVal) {
+		set[value] = true
+	}
+	return set
+}
+
 // numbConvert is a helper function for the Comparison map.
 // Returns 2 float64 numbers, and a bool whether the conversion failed.
 func numbConvert(iv any, fv string) (float64, float64, bool) {
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrPreconditionFailed = errors.New("Precondition failed - The entry has changed since it was read")
+
+// ETag returns a strong ETag for a value, computed from its JSON content.
+// Maps are marshalled with sorted keys, so the same content always gives the same tag.
+func ETag(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak ETag for a value - Used for lists, where the tag covers a page rather than an entry
+func WeakETag(value any) string {
+	return "W/" + ETag(value)
+}
+
+// checkIfMatch compares an entry to an If-Match header (strong comparison, RFC 9110).
+// An empty header always passes, "*" passes for any existing entry. item is nil when the entry doesn't exist.
+func checkIfMatch(item map[string]any, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	if item == nil {
+		return ErrPreconditionFailed
+	}
+
+	current := ETag(item)
+	for tag := range strings.SplitSeq(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return nil
+		}
+	}
+
+	return ErrPreconditionFailed
+}
+
+// MatchesIfNoneMatch compares an ETag to an If-None-Match header (weak comparison, RFC 9110).
+// Reports true when the client's copy is still current - A 304 for GET requests.
+func MatchesIfNoneMatch(etag string, ifNoneMatch string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+
+	current := strings.TrimPrefix(etag, "W/")
+	for tag := range strings.SplitSeq(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// PUT and PATCH on a singular resource only go through when If-Match holds the current ETag
+func TestResourceIfMatch(t *testing.T) {
+	s := newTestService(t)
+	profile, err := s.ReplaceResource("profile", map[string]any{"name": "ole"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := ETag(profile)
+
+	updates := []struct {
+		name   string
+		update func(ifMatch string) (map[string]any, error)
+	}{
+		{"update", func(ifMatch string) (map[string]any, error) {
+			return s.UpdateResource("profile", map[string]any{"age": 1}, ifMatch)
+		}},
+		{"merge patch", func(ifMatch string) (map[string]any, error) {
+			return s.MergePatchResource("profile", map[string]any{"age": 2}, ifMatch)
+		}},
+		{"replace", func(ifMatch string) (map[string]any, error) {
+			return s.ReplaceResource("profile", map[string]any{"name": "new"}, ifMatch)
+		}},
+	}
+
+	for _, tt := range updates {
+		t.Run(tt.name, func(t *testing.T) {
+			current, _ := s.GetResource("profile")
+			if _, err := tt.update(`"stale"`); !errors.Is(err, ErrPreconditionFailed) {
+				t.Fatalf("got %v, want ErrPreconditionFailed", err)
+			}
+			if unchanged, _ := s.GetResource("profile"); ETag(unchanged) != ETag(current) {
+				t.Fatalf("resource changed on a failed precondition: %v", unchanged)
+			}
+
+			item, err := tt.update(ETag(current))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ETag(item) == ETag(current) {
+				t.Errorf("resource didn't change: %v", item)
+			}
+		})
+	}
+
+	// The tag from the first PUT is long gone
+	if _, err := s.UpdateResource("profile", map[string]any{"age": 3}, stale); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("got %v, want ErrPreconditionFailed", err)
+	}
+	// A resource that doesn't exist yet has no tag to match
+	if _, err := s.ReplaceResource("settings", map[string]any{}, "*"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("got %v, want ErrPreconditionFailed", err)
+	}
+}
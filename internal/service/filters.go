@@ -1,12 +1,76 @@
 package service
 
 import (
+	"errors"
+	"slices"
 	"strings"
 )
 
+var (
+	ErrInvalidFilter = errors.New("Invalid filter")
+)
+
+// filter is a single query filter (title_contains=go), parsed and compiled once per request
+type filter struct {
+	key   string // the query parameter as given (title_contains)
+	field string
+	op    string
+	value string
+	match Matcher
+	// literal compares the whole key for equality - For entries that have a field named like a filter with an
+	// operator (logged_in), which keeps meaning logged_in == value for them. nil for a key without an operator.
+	literal Matcher
+	err     error // ErrInvalidFilter if the operator can't use the value, like a regex that doesn't compile
+}
+
+// Filters are the filters of a request, parsed and compiled once and sorted by parameter.
+// The same Filters are validated (ValidateFilters) and applied (GetAll), so a regex is only compiled the one time.
+type Filters []filter
+
+// CompileFilters parses and compiles the filters of a request. A value the operator can't use doesn't stop the rest -
+// It's reported by Err and ValidateFilters.
+func CompileFilters(filters map[string]string) Filters {
+	compiled := make(Filters, 0, len(filters))
+	for rawKey, filterValue := range filters {
+		compiled = append(compiled, compileFilter(rawKey, filterValue))
+	}
+	slices.SortFunc(compiled, func(a, b filter) int { return strings.Compare(a.key, b.key) })
+
+	return compiled
+}
+
+// compileFilter parses and compiles a single filter
+func compileFilter(rawKey, filterValue string) filter {
+	// Parse field + operator (title_contains -> field="title", op="contains")
+	field, op := parseFilterKey(rawKey)
+
+	match, err := Compile(op, filterValue)
+	f := filter{key: rawKey, field: field, op: op, value: filterValue, match: match, err: err}
+	if field != rawKey {
+		f.literal, _ = Compile("eq", filterValue)
+	}
+	return f
+}
+
+// Err returns the error of the first filter the operator couldn't use, nil if there are none
+func (filters Filters) Err() error {
+	for _, f := range filters {
+		if f.err != nil {
+			return f.err
+		}
+	}
+	return nil
+}
+
+// compileFilters compiles the filters of a request, failing with ErrInvalidFilter on a value the operator can't use
+func compileFilters(filters map[string]string) ([]filter, error) {
+	compiled := CompileFilters(filters)
+	return compiled, compiled.Err()
+}
+
 // applyFilters takes in a collection of items and filters to apply.
 // Returns a collection of items with filters applied.
-func applyFilters(items []map[string]any, filters map[string]string) []map[string]any {
+func applyFilters(items []map[string]any, filters []filter) []map[string]any {
 	// early return if there are no filters to apply
 	if len(filters) == 0 {
 		return items
@@ -15,29 +79,68 @@ func applyFilters(items []map[string]any, filters map[string]string) []map[strin
 	result := make([]map[string]any, 0, len(items))
 
 	for _, item := range items {
-		match := true
+		if matchesFilters(item, filters) { result = append(result, item) }
+	}
 
-		for rawKey, filterValue := range filters {
-			// Parse field + operator (title_contains -> field="title", op="contains")
-			field, op := parseFilterKey(rawKey)
+	return result
+}
 
-			itemValue := item[field]
-			if itemValue == nil {
-				match = false
-				break
-			}
+// candidates returns the entries of a collection that could pass the filters. An eq or in filter on an indexed
+// field narrows them down through the index - Otherwise it's the whole collection, left for applyFilters to scan.
+func (s *Service) candidates(collection string, filters []filter) ([]map[string]any, bool) {
+	for _, f := range filters {
+		var values []string
+		switch f.op {
+		case "eq":
+			values = []string{f.value}
+		case "in":
+			values = splitList(f.value)
+		default:
+			continue
+		}
+
+		items, ok := s.DB.Lookup(collection, f.field, values)
+		// Entries with the whole key (logged_in) are compared to it instead, and the index on logged would miss them
+		if ok && (f.literal == nil || !s.DB.HasField(collection, f.key)) {
+			return items, true
+		}
+	}
+
+	return s.DB.GetCollection(collection)
+}
 
-			comparator := GetComparator(op)
-			if !comparator(itemValue, filterValue) {
-				match = false
-				break
+// matchingIndexes returns the positions of the items that pass every filter
+func matchingIndexes(items []map[string]any, filters []filter) []int {
+	indexes := []int{}
+	for i, item := range items {
+		if matchesFilters(item, filters) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+// matchesFilters reports whether a single item passes every filter
+func matchesFilters(item map[string]any, filters []filter) bool {
+	for _, f := range filters {
+		if f.literal != nil {
+			if itemValue, ok := resolvePath(item, f.key); ok {
+				if !f.literal(itemValue) {
+					return false
+				}
+				continue
 			}
 		}
 
-		if match { result = append(result, item) }
+		// Dotted paths reach into nested objects and arrays (author.name, tags.0)
+		itemValue, _ := resolvePath(item, f.field)
+		if !f.match(itemValue) {
+			return false
+		}
 	}
 
-	return result
+	return true
 }
 
 // Expand as needed
@@ -49,15 +152,26 @@ var operatorSuffixes = map[string]string{
 	"_ne": "ne",
 	"_contains": "contains",
 	"_like": "contains", // alias
+	"_eq": "eq", // same as no suffix - Case sensitive
+	"_ieq": "ieq", // case insensitive equality
+	"_in": "in", // a,b,c
+	"_nin": "nin",
+	"_exists": "exists", // true or false - null counts as missing
+	"_regex": "regex", // Go (RE2) syntax
 }
 
 // parseFilterKey takes in a key (I.E: author_contains/author_like) and returns the field and the operations (author, contains)
 func parseFilterKey(key string) (field, op string) {
-	for suffix, operator := range operatorSuffixes {
-		if trimmed, ok := strings.CutSuffix(key, suffix); ok {
-			return trimmed, operator
+	// The longest suffix wins - status_nin ends in _in as well
+	longest := ""
+	for suffix := range operatorSuffixes {
+		if len(suffix) > len(longest) && strings.HasSuffix(key, suffix) {
+			longest = suffix
 		}
 	}
+	if longest != "" {
+		return strings.TrimSuffix(key, longest), operatorSuffixes[longest]
+	}
 	// If the loop didn't find any matching operators, return the input and "eq" for equals.
 	// Could do lots of guard rails and edge cases, but that feels like a deep rabbit-hole to go down.
 	return key, "eq"
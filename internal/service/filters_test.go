@@ -0,0 +1,143 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterOperators(t *testing.T) {
+	items := []map[string]any{
+		{"id": "1", "status": "active", "email": "ole@corp.no", "deletedAt": nil},
+		{"id": "2", "status": "Draft", "email": "ada@example.com", "deletedAt": "2024-01-01"},
+		{"id": "3", "status": "archived"},
+	}
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    []string
+	}{
+		{"in", map[string]string{"status_in": "active,archived"}, []string{"1", "3"}},
+		{"nin", map[string]string{"status_nin": "active"}, []string{"2", "3"}},
+		{"exists", map[string]string{"email_exists": "true"}, []string{"1", "2"}},
+		{"null counts as missing", map[string]string{"deletedAt_exists": "false"}, []string{"1", "3"}},
+		{"regex", map[string]string{"email_regex": `^.*@corp\.no$`}, []string{"1"}},
+		{"eq is case sensitive", map[string]string{"status_eq": "draft"}, []string{}},
+		{"ieq ignores case", map[string]string{"status_ieq": "draft"}, []string{"2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileFilters(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(applyFilters(items, compiled)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := compileFilters(map[string]string{"email_regex": "("}); err == nil {
+		t.Error("got no error for an invalid regex")
+	}
+}
+
+// Fields that happen to end like an operator (logged_in, is_regex) keep matching by equality where entries have them
+func TestFilterLiteralKeys(t *testing.T) {
+	items := []map[string]any{
+		{"id": "1", "logged_in": true, "logged": "true"},
+		{"id": "2", "logged_in": false, "logged": "true"},
+		{"id": "3", "logged": "true"},
+		{"id": "4", "profile": map[string]any{"opted_in": "yes"}},
+	}
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    []string
+	}{
+		{"whole key where entries have it", map[string]string{"logged_in": "true"}, []string{"1", "3"}},
+		{"the other value", map[string]string{"logged_in": "false"}, []string{"2"}},
+		{"nested key", map[string]string{"profile.opted_in": "yes"}, []string{"4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileFilters(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(applyFilters(items, compiled)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// An index on the field before the suffix mustn't hide the entries that have the whole key
+func TestFilterLiteralKeysWithIndex(t *testing.T) {
+	s := newTestService(t)
+	for _, item := range []map[string]any{
+		{"id": "1", "logged": "a"},
+		{"id": "2", "logged_in": "a"},
+		{"id": "3", "logged": "b"},
+	} {
+		if _, err := s.Create("users", item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.DB.AddIndex("users", "logged")
+
+	items, _, err := s.GetAll("users", CompileFilters(map[string]string{"logged_in": "a"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(items); !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("got %v, want [1 2]", got)
+	}
+
+	// Without such entries the index is used as before
+	if _, err := s.Delete("users", "2", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	items, _, _ = s.GetAll("users", CompileFilters(map[string]string{"logged_in": "a,b"}), nil)
+	if got := ids(items); !slices.Equal(got, []string{"1", "3"}) {
+		t.Errorf("got %v, want [1 3]", got)
+	}
+}
+
+// Every operator a filter can use is in Comparisons as well
+func TestGetComparator(t *testing.T) {
+	for op := range compilers {
+		if _, ok := Comparisons[op]; !ok {
+			t.Errorf("operator %q is missing from Comparisons", op)
+		}
+	}
+	for _, op := range operatorSuffixes {
+		if _, ok := Comparisons[op]; !ok {
+			t.Errorf("operator %q is missing from Comparisons", op)
+		}
+	}
+
+	tests := []struct {
+		op    string
+		item  any
+		value string
+		want  bool
+	}{
+		{"in", "b", "a,b", true},
+		{"in", "c", "a,b", false},
+		{"nin", "c", "a,b", true},
+		{"regex", "ole@corp.no", `@corp\.no$`, true},
+		{"regex", "x", "(", false},
+		{"exists", nil, "false", true},
+		{"exists", "x", "false", false},
+		{"ieq", "Draft", "draft", true},
+	}
+	for _, tt := range tests {
+		if got := GetComparator(tt.op)(tt.item, tt.value); got != tt.want {
+			t.Errorf("%s(%v, %q) = %v, want %v", tt.op, tt.item, tt.value, got, tt.want)
+		}
+	}
+}
@@ -1,31 +1,9 @@
 package service
 
 import (
-	"fmt"
-	"strconv"
 	"strings"
 )
 
-// generateID takes in a collection of Items, checks the IDs already present and gets highest number
-// Returns the highest number + 1. Simple incrementing ID.
-func generateID(items []map[string]any) string {
-	max := 0
-
-	// Items could have been deleted, leaving a potential void -> Can't utilize just len()
-	for _, item := range items {
-		idString := fmt.Sprint(item["id"])
-		id, err := strconv.Atoi(idString)
-		if err != nil {
-			continue
-		}
-		
-		if id > max {
-			max = id
-		}
-	}
-	return strconv.Itoa(max + 1)
-}
-
 // normalizeInput takes in an input string and removes any white space and makes it lowercase before returning it
 func normalizeInput(input string) string {
 	normalizedInput := strings.TrimSpace(input)
@@ -34,24 +12,53 @@ func normalizeInput(input string) string {
 	return normalizedInput
 }
 
-// ensureCollectionExists takes in the name of a collection and checks whether it's in the database
-// Create a new collection with that name if it doesn't exist
-func (s *Service) ensureCollectionExists(name string) {
-	if items, ok := s.DB.GetCollection(name); !ok {
-		items = []map[string]any{}
-		s.DB.UpdateCollection(name, items)
+// singular turns a collection name into the name used for foreign keys (posts -> post, categories -> category)
+// Only handles the regular english plurals, which covers most mock APIs.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ss"):
+		return name
+	default:
+		return strings.TrimSuffix(name, "s")
 	}
 }
 
-// findByID takes in a slice of items and the ID for the wanted entry.
-// Returns that item if it exists and the index of it. Otherwise return nil and -1
-func (s *Service) findByID(items []map[string]any, id string) (map[string]any, int) {
+// plural is the reverse of singular (post -> posts, category -> categories)
+func plural(name string) string {
+	switch {
+	case len(name) > 1 && strings.HasSuffix(name, "y") && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		return strings.TrimSuffix(name, "y") + "ies"
+	case strings.HasSuffix(name, "s"):
+		return name + "es"
+	default:
+		return name + "s"
+	}
+}
 
-	for i, item := range items {
-		if fmt.Sprint(item["id"]) == id {
-			return item, i
+// deepCopy copies a decoded JSON value all the way down, so changes to the copy never reach the DB's data
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, nested := range v {
+			copied[key] = deepCopy(nested)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, nested := range v {
+			copied[i] = deepCopy(nested)
 		}
+		return copied
+	case []map[string]any:
+		copied := make([]map[string]any, len(v))
+		for i, nested := range v {
+			copied[i] = deepCopy(nested).(map[string]any)
+		}
+		return copied
+	default:
+		return v
 	}
-
-	return nil, -1
 }
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// ID strategies a collection can be configured with
+const (
+	IDIncrement = "increment" // 1, 2, 3 ... (the default)
+	IDUUIDv4    = "uuidv4"    // random UUID
+	IDUUIDv7    = "uuidv7"    // time ordered UUID
+	IDULID      = "ulid"      // time ordered, 26 characters of Crockford base32
+	IDNanoID    = "nanoid"    // 21 URL safe random characters
+)
+
+// idGenerators holds every strategy besides increment, which needs the counter on the Service
+var idGenerators = map[string]func() string{
+	IDUUIDv4: newUUIDv4,
+	IDUUIDv7: newUUIDv7,
+	IDULID:   newULID,
+	IDNanoID: newNanoID,
+}
+
+// ValidIDStrategy reports whether name is an ID strategy the service knows
+func ValidIDStrategy(name string) bool {
+	_, ok := idGenerators[name]
+	return ok || name == IDIncrement
+}
+
+// counter remembers the last incrementing ID handed out for a collection, so a new ID doesn't need a scan.
+// generation ties it to the DB data it was counted from - A reset or reload starts the count over.
+type counter struct {
+	last       int
+	generation uint64
+}
+
+// nextID generates the ID for a new entry in collection, using the collection's configured strategy.
+// Only called within a transaction - The write lock is what keeps the counters consistent.
+func (s *Service) nextID(tx *db.Tx[model.Data], collection string) string {
+	if generate, ok := idGenerators[s.Config.Collection(collection).IDStrategy]; ok {
+		return generate()
+	}
+
+	c := s.counter(tx, collection)
+	c.last++
+	return strconv.Itoa(c.last)
+}
+
+// observeID moves the counter past an ID that was supplied by the client, so it's never generated again
+func (s *Service) observeID(tx *db.Tx[model.Data], collection string, id any) {
+	if s.Config.Collection(collection).IDStrategy != IDIncrement {
+		return
+	}
+
+	c := s.counter(tx, collection)
+	if n, err := strconv.Atoi(fmt.Sprint(id)); err == nil && n > c.last {
+		c.last = n
+	}
+}
+
+// counter returns the increment counter of a collection. The collection is only scanned the first time
+// (or after the data was swapped out), every ID after that is O(1).
+// Counters only ever go up, so IDs of deleted entries aren't handed out again while the server runs.
+func (s *Service) counter(tx *db.Tx[model.Data], collection string) *counter {
+	c, ok := s.counters[collection]
+	if ok && c.generation == tx.Generation() {
+		return c
+	}
+
+	items, _ := tx.GetCollection(collection)
+	c = &counter{last: maxNumericID(items, tx.KeyField(collection)), generation: tx.Generation()}
+	s.counters[collection] = c
+	return c
+}
+
+// saveCounters copies the increment counters, so a transaction that's rolled back can hand its IDs back with restoreCounters
+func (s *Service) saveCounters() map[string]counter {
+	saved := make(map[string]counter, len(s.counters))
+	for collection, c := range s.counters {
+		saved[collection] = *c
+	}
+	return saved
+}
+
+// restoreCounters puts the counters back the way saveCounters found them.
+// Counters that were created since are dropped - They're counted again from the data the next time.
+func (s *Service) restoreCounters(saved map[string]counter) {
+	s.counters = make(map[string]*counter, len(saved))
+	for collection, c := range saved {
+		s.counters[collection] = &c
+	}
+}
+
+// maxNumericID returns the highest numeric ID in items, 0 if there are none.
+// Items could have been deleted, leaving a potential void -> Can't utilize just len()
+func maxNumericID(items []map[string]any, key string) int {
+	max := 0
+	for _, item := range items {
+		id, err := strconv.Atoi(fmt.Sprint(item[key]))
+		if err != nil {
+			continue
+		}
+		if id > max {
+			max = id
+		}
+	}
+	return max
+}
+
+// newUUIDv4 returns a random (version 4) UUID
+func newUUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return formatUUID(b, 4)
+}
+
+// newUUIDv7 returns a version 7 UUID - 48 bits of unix milliseconds followed by random bits, so they sort by creation time
+func newUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(b[:6], ts[2:])
+
+	return formatUUID(b, 7)
+}
+
+// formatUUID stamps the version and RFC 9562 variant bits on b and formats it as 8-4-4-4-12 hex
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
+
+// Crockford's base32 - No I, L, O or U to avoid mixups
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID - 48 bits of unix milliseconds and 80 random bits, as 26 characters of Crockford base32
+func newULID() string {
+	var b [16]byte
+	rand.Read(b[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(b[:6], ts[2:])
+
+	// 128 bits in 26 characters of 5 bits - The first character only carries the top 3 bits
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// The URL safe alphabet nanoid uses by default - 64 characters, so every random byte maps evenly onto it
+const nanoidAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-"
+
+// newNanoID returns a 21 character random ID in the style of nanoid
+func newNanoID() string {
+	var b [21]byte
+	rand.Read(b[:])
+
+	for i := range b {
+		b[i] = nanoidAlphabet[b[i]&63]
+	}
+	return string(b[:])
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddIndex declares a secondary index on a field of a collection, so equality filters on it skip the scan.
+// Only top level fields can be indexed - Filters on dotted paths (author.name) keep scanning.
+func (s *Service) AddIndex(collection string, field string) error {
+	collection = normalizeInput(collection)
+	field = strings.TrimSpace(field)
+
+	if collection == "" || field == "" {
+		return fmt.Errorf("%w: collection and field are required", ErrInvalidIndex)
+	}
+	if strings.Contains(field, ".") {
+		return fmt.Errorf("%w: only top level fields can be indexed, not %q", ErrInvalidIndex, field)
+	}
+
+	s.DB.AddIndex(collection, field)
+	return nil
+}
+
+// Indexes returns the indexed fields of every collection that has any
+func (s *Service) Indexes() map[string][]string {
+	return s.DB.Indexes()
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+var (
+	ErrInvalidPatch    = errors.New("Invalid JSON Patch")
+	ErrPatchTestFailed = errors.New("JSON Patch test failed")
+)
+
+// PatchOp is a single RFC 6902 JSON Patch operation.
+// Value is kept raw - A missing value (an invalid add) has to be told apart from null (a valid one).
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// value decodes the value of an add, replace or test
+func (op PatchOp) value() (any, error) {
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("%s needs a value", op.Op)
+	}
+	var value any
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	return value, nil
+}
+
+// PATCH /:name/:id (application/json-patch+json) -> Applies a JSON Patch (RFC 6902) to an entry.
+// The operations are applied to a copy, so if any of them fails (a test that doesn't match, a path that
+// doesn't exist) the entry is left exactly as it was. The id can't be patched away.
+func (s *Service) JSONPatch(collection string, id string, ops []PatchOp, ifMatch string) (map[string]any, error) {
+	collection = normalizeInput(collection)
+
+	var patched map[string]any
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		if !tx.HasCollection(collection) {
+			return ErrCollectionNotFound
+		}
+		item, index := tx.Find(collection, id)
+		if index == -1 {
+			return ErrEntryNotFound
+		}
+		if err := checkIfMatch(item, ifMatch); err != nil {
+			return err
+		}
+
+		result, err := applyJSONPatch(item, ops)
+		if err != nil {
+			return err
+		}
+		key := tx.KeyField(collection)
+		result[key] = item[key]
+
+		patched = result
+		tx.Replace(collection, index, patched)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// applyJSONPatch applies ops in order to a deep copy of doc and returns the result
+func applyJSONPatch(doc map[string]any, ops []PatchOp) (map[string]any, error) {
+	var current any = deepCopy(doc)
+
+	for i, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d - %v", ErrInvalidPatch, i, err)
+		}
+
+		var value any
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if value, err = op.value(); err != nil {
+				return nil, fmt.Errorf("%w: operation %d - %v", ErrInvalidPatch, i, err)
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			current, err = pointerAdd(current, path, value)
+		case "remove":
+			current, _, err = pointerRemove(current, path)
+		case "replace":
+			// Same as remove + add, but the target has to exist. The whole document (path "") always does.
+			if len(path) == 0 {
+				current = value
+				break
+			}
+			if _, err = pointerGet(current, path); err == nil {
+				current, _, err = pointerRemove(current, path)
+			}
+			if err == nil {
+				current, err = pointerAdd(current, path, value)
+			}
+		case "move", "copy":
+			var from []string
+			from, err = parsePointer(op.From)
+			if err != nil {
+				break
+			}
+			if op.Op == "move" && isPrefix(from, path) && len(from) < len(path) {
+				err = errors.New("can't move a value into one of its own children")
+				break
+			}
+
+			if value, err = pointerGet(current, from); err != nil {
+				break
+			}
+			if op.Op == "move" {
+				current, _, err = pointerRemove(current, from)
+			} else {
+				value = deepCopy(value)
+			}
+			if err == nil {
+				current, err = pointerAdd(current, path, value)
+			}
+		case "test":
+			var actual any
+			if actual, err = pointerGet(current, path); err != nil {
+				break
+			}
+			if !reflect.DeepEqual(actual, value) {
+				return nil, fmt.Errorf("%w: operation %d - %s doesn't hold the expected value", ErrPatchTestFailed, i, op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d - %v", ErrInvalidPatch, i, err)
+		}
+	}
+
+	// Entries have to stay objects
+	result, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: the result is not an object", ErrInvalidPatch)
+	}
+
+	return result, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens. "" is the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token. "-" (the end of the array) is only allowed when allowEnd is set.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+
+	index, err := strconv.Atoi(token)
+	// No leading zeros or signs, per RFC 6901
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("index %d is out of bounds", index)
+	}
+
+	return index, nil
+}
+
+// pointerGet returns the value at path
+func pointerGet(doc any, path []string) (any, error) {
+	current := doc
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path /%s doesn't exist", strings.Join(path, "/"))
+			}
+			current = value
+		case []any:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path /%s doesn't exist", strings.Join(path, "/"))
+		}
+	}
+
+	return current, nil
+}
+
+// pointerAdd adds value at path and returns the new document.
+// Objects get the member set, arrays get the value inserted at the index (or appended with "-").
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("parent of the path doesn't exist at %q", token)
+		}
+		updated, err := pointerAdd(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []any:
+		if len(path) == 1 {
+			index, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerAdd(node[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = updated
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("can't add to a value at %q that isn't an object or array", token)
+}
+
+// pointerRemove removes the value at path. Returns the new document and the removed value.
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("can't remove the whole document")
+	}
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path doesn't exist at %q", token)
+		}
+		if len(path) == 1 {
+			delete(node, token)
+			return node, child, nil
+		}
+		updated, removed, err := pointerRemove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = updated
+		return node, removed, nil
+	case []any:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := node[index]
+			return append(node[:index], node[index+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(node[index], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[index] = updated
+		return node, removed, nil
+	}
+
+	return nil, nil, fmt.Errorf("path doesn't exist at %q", token)
+}
+
+// isPrefix reports whether prefix is the start of path
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
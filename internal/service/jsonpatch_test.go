@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := map[string]any{"id": "1", "title": "Hello", "draft": nil}
+
+	tests := []struct {
+		name    string
+		ops     string
+		want    map[string]any
+		wantErr error
+	}{
+		{"replace the whole document", `[{"op":"replace","path":"","value":{"title":"New"}}]`, map[string]any{"title": "New"}, nil},
+		{"add the whole document", `[{"op":"add","path":"","value":{"title":"New"}}]`, map[string]any{"title": "New"}, nil},
+		{"add null", `[{"op":"add","path":"/x","value":null}]`, map[string]any{"id": "1", "title": "Hello", "draft": nil, "x": nil}, nil},
+		{"add without a value", `[{"op":"add","path":"/x"}]`, nil, ErrInvalidPatch},
+		{"replace without a value", `[{"op":"replace","path":"/title"}]`, nil, ErrInvalidPatch},
+		{"test for null", `[{"op":"test","path":"/draft","value":null}]`, doc, nil},
+		{"test for null on a value", `[{"op":"test","path":"/title","value":null}]`, nil, ErrPatchTestFailed},
+		{"test without a value", `[{"op":"test","path":"/draft"}]`, nil, ErrInvalidPatch},
+		{"replace the document with something else", `[{"op":"replace","path":"","value":[1]}]`, nil, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []PatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := applyJSONPatch(doc, ops)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
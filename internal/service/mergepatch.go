@@ -0,0 +1,89 @@
+package service
+
+import (
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// PATCH /:name/:id (application/merge-patch+json) -> Applies a JSON Merge Patch (RFC 7396) to an entry.
+// Unlike Update, nested objects are merged recursively instead of replaced, and null removes a field.
+// The id can't be patched away. ifMatch works the same way as for Replace.
+func (s *Service) MergePatch(collection string, id string, patch map[string]any, ifMatch string) (map[string]any, error) {
+	collection = normalizeInput(collection)
+
+	var merged map[string]any
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		if !tx.HasCollection(collection) {
+			return ErrCollectionNotFound
+		}
+		item, index := tx.Find(collection, id)
+		if index == -1 {
+			return ErrEntryNotFound
+		}
+		if err := checkIfMatch(item, ifMatch); err != nil {
+			return err
+		}
+
+		merged = mergePatch(deepCopy(item), patch).(map[string]any)
+		key := tx.KeyField(collection)
+		merged[key] = item[key]
+
+		tx.Replace(collection, index, merged)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// PATCH /:name (application/merge-patch+json) -> Applies a JSON Merge Patch (RFC 7396) to a singular resource
+func (s *Service) MergePatchResource(name string, patch map[string]any, ifMatch string) (map[string]any, error) {
+	name = normalizeInput(name)
+
+	var merged map[string]any
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		item, exists := tx.GetResource(name)
+		if !exists {
+			return ErrResourceNotFound
+		}
+		if err := checkIfMatch(item, ifMatch); err != nil {
+			return err
+		}
+
+		merged = mergePatch(deepCopy(item), patch).(map[string]any)
+		tx.SetResource(name, merged)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// mergePatch is the MergePatch function from RFC 7396.
+// target is changed in place where possible, so pass in a copy.
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		// Anything but an object replaces the target outright
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// foreignKey returns the field children of a collection use to point at their parent (posts -> postId)
+func foreignKey(parent string) string {
+	return singular(normalizeInput(parent)) + "Id"
+}
+
+// GET /:parent/:id/:child -> Returns the entries of child that belong to the parent entry (/posts/1/comments)
+// The foreign key is just another equality filter, so filtering, sorting and pagination work as in GetAll.
+func (s *Service) GetNested(parent, id, child string, filters Filters, controls map[string]string) ([]map[string]any, int, error) {
+	if s.GetByID(parent, id, nil) == nil {
+		return nil, 0, ErrEntryNotFound
+	}
+
+	// The path decides the parent - A foreign key filter in the query is replaced
+	key := foreignKey(parent)
+	nestedFilters := slices.DeleteFunc(slices.Clone(filters), func(f filter) bool { return f.key == key })
+	nestedFilters = append(nestedFilters, compileFilter(key, id))
+
+	return s.GetAll(child, nestedFilters, controls)
+}
+
+// POST /:parent/:id/:child -> Creates a new entry in child that belongs to the parent entry.
+// The foreign key is set from the path, whatever the body says.
+func (s *Service) CreateNested(parent, id, child string, item map[string]any) (map[string]any, error) {
+	parent = normalizeInput(parent)
+	child = normalizeInput(child)
+
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		// The parent has to exist - Checked in the same transaction so it can't disappear in between
+		if !tx.HasCollection(parent) {
+			return ErrCollectionNotFound
+		}
+		if _, index := tx.Find(parent, id); index == -1 {
+			return ErrEntryNotFound
+		}
+
+		item[foreignKey(parent)] = id
+		return s.insert(tx, child, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
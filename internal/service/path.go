@@ -0,0 +1,123 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+)
+
+// resolvePath looks up a field in an entry by its dotted path (author.name, tags.0, comments.1.body).
+// A key that contains dots itself is matched as-is first, so existing data with such keys keeps working.
+// Returns the value and whether the path exists.
+func resolvePath(item map[string]any, path string) (any, bool) {
+	if value, ok := item[path]; ok {
+		return value, true
+	}
+	if !strings.Contains(path, ".") {
+		return nil, false
+	}
+
+	var current any = item
+	for segment := range strings.SplitSeq(path, ".") {
+		next, ok := step(current, segment)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+
+	return current, true
+}
+
+// step goes one level down into value - A key for objects, an index for arrays
+func step(value any, segment string) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		next, ok := v[segment]
+		return next, ok
+	case []any:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, false
+		}
+		return v[index], true
+	case []map[string]any:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, false
+		}
+		return v[index], true
+	}
+
+	return nil, false
+}
+
+// eachValue calls fn for every value nested inside value (objects and arrays, all the way down), and value itself.
+// Stops as soon as fn returns true, and reports whether it did.
+func eachValue(value any, fn func(any) bool) bool {
+	if fn(value) {
+		return true
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, nested := range v {
+			if eachValue(nested, fn) {
+				return true
+			}
+		}
+	case []any:
+		for _, nested := range v {
+			if eachValue(nested, fn) {
+				return true
+			}
+		}
+	case []map[string]any:
+		for _, nested := range v {
+			if eachValue(nested, fn) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// project keeps only the given fields (_fields=title,author.name) of every item.
+// Nested paths keep their structure - author.name gives {"author": {"name": ...}}.
+func project(items []map[string]any, fields []string) []map[string]any {
+	if len(fields) == 0 {
+		return items
+	}
+
+	result := make([]map[string]any, len(items))
+	for i, item := range items {
+		projected := map[string]any{}
+		for _, field := range fields {
+			value, ok := resolvePath(item, field)
+			if !ok {
+				continue
+			}
+			if _, literal := item[field]; literal {
+				projected[field] = value
+				continue
+			}
+			setPath(projected, strings.Split(field, "."), value)
+		}
+		result[i] = projected
+	}
+
+	return result
+}
+
+// setPath stores value in out under the path, creating the objects along the way
+func setPath(out map[string]any, segments []string, value any) {
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := out[segment].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			out[segment] = next
+		}
+		out = next
+	}
+	out[segments[len(segments)-1]] = value
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	item := map[string]any{
+		"id":        "1",
+		"title":     "Hello",
+		"author":    map[string]any{"name": "Ada", "age": 36},
+		"meta.tags": "literal",
+	}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   map[string]any
+	}{
+		{"top level fields", []string{"id", "title"}, map[string]any{"id": "1", "title": "Hello"}},
+		{"nested field keeps its structure", []string{"id", "author.name"}, map[string]any{"id": "1", "author": map[string]any{"name": "Ada"}}},
+		{"two fields of the same object", []string{"author.name", "author.age"}, map[string]any{"author": map[string]any{"name": "Ada", "age": 36}}},
+		{"key with a dot in it", []string{"meta.tags"}, map[string]any{"meta.tags": "literal"}},
+		{"missing fields are left out", []string{"id", "author.email", "views"}, map[string]any{"id": "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := project([]map[string]any{item}, tt.fields)[0]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("_fields=%v got %v, want %v", tt.fields, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// applyRelations attaches related entries to items, based on the _embed and _expand controls.
+// Runs after filtering and pagination, so only the entries that are actually returned get looked at.
+// The items are copied before anything is attached - They're shared with the DB.
+func (s *Service) applyRelations(collection string, items []map[string]any, controls map[string]string) []map[string]any {
+	embeds := splitList(controls["_embed"])
+	expands := splitList(controls["_expand"])
+	if len(items) == 0 || (len(embeds) == 0 && len(expands) == 0) {
+		return items
+	}
+
+	result := make([]map[string]any, len(items))
+	for i, item := range items {
+		result[i] = maps.Clone(item)
+	}
+
+	for _, child := range embeds {
+		s.embed(collection, result, child)
+	}
+	for _, parent := range expands {
+		s.expand(result, parent)
+	}
+
+	return result
+}
+
+// embed attaches the entries of the child collection that point back to each item.
+// posts + _embed=comments -> every post gets a "comments" list with the comments where postId matches its id.
+func (s *Service) embed(collection string, items []map[string]any, child string) {
+	foreignKey := singular(collection) + "Id"
+	primaryKey := s.DB.KeyField(collection)
+
+	// Only the IDs on this page are interesting
+	wanted := make(map[string][]map[string]any, len(items))
+	for _, item := range items {
+		wanted[fmt.Sprint(item[primaryKey])] = []map[string]any{}
+	}
+
+	children, _ := s.DB.GetCollection(normalizeInput(child))
+	for _, entry := range children {
+		value, ok := entry[foreignKey]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprint(value)
+		if list, ok := wanted[key]; ok {
+			wanted[key] = append(list, entry)
+		}
+	}
+
+	for _, item := range items {
+		item[child] = wanted[fmt.Sprint(item[primaryKey])]
+	}
+}
+
+// expand attaches the parent entry each item points to.
+// posts + _expand=user -> every post gets a "user" object, the entry in users with the id of its userId.
+func (s *Service) expand(items []map[string]any, parent string) {
+	foreignKey := parent + "Id"
+
+	// users is the usual name, but fall back to the name as given (_expand=staff -> staff)
+	name := normalizeInput(plural(parent))
+	parents, ok := s.DB.GetCollection(name)
+	if !ok {
+		name = normalizeInput(parent)
+		parents, _ = s.DB.GetCollection(name)
+	}
+	primaryKey := s.DB.KeyField(name)
+
+	wanted := make(map[string]map[string]any, len(items))
+	for _, item := range items {
+		if value, ok := item[foreignKey]; ok {
+			wanted[fmt.Sprint(value)] = nil
+		}
+	}
+
+	for _, entry := range parents {
+		id := fmt.Sprint(entry[primaryKey])
+		if _, ok := wanted[id]; ok {
+			wanted[id] = entry
+		}
+	}
+
+	for _, item := range items {
+		value, ok := item[foreignKey]
+		if !ok {
+			continue
+		}
+		// Dangling references are left out, same as the original json-server
+		if entry := wanted[fmt.Sprint(value)]; entry != nil {
+			item[parent] = entry
+		}
+	}
+}
+
+// splitList splits a comma separated control value (comments,likes) into its parts
+func splitList(value string) []string {
+	var parts []string
+	for part := range strings.SplitSeq(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"strings"
+)
+
+// applySearch takes in a collection of items and a search string (_q).
+// Returns the items where any string value contains the search string, ignoring case.
+// Nested objects and arrays are searched as well.
+func applySearch(items []map[string]any, q string) []map[string]any {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return items
+	}
+
+	result := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if containsText(item, q) {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// containsText walks through a value and reports whether any string in it contains q (already lowercased)
+// Numbers, booleans and null aren't text.
+func containsText(value any, q string) bool {
+	return eachValue(value, func(v any) bool {
+		str, ok := v.(string)
+		return ok && strings.Contains(strings.ToLower(str), q)
+	})
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// searchItems covers the shapes _q has to look through
+func searchItems() []map[string]any {
+	return []map[string]any{
+		{"id": "1", "title": "Hello World", "views": 10},
+		{"id": "2", "title": "Other", "author": map[string]any{"name": "Ada HELLO", "age": 36}},
+		{"id": "3", "title": "Tagged", "tags": []any{"go", map[string]any{"label": "hello-go"}}},
+		{"id": "4", "title": "Numbers", "views": 12345, "published": true, "deleted": nil},
+		{"id": "5", "title": "Nothing here"},
+	}
+}
+
+// ids returns the ids of items in order
+func ids(items []map[string]any) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, fmt.Sprint(item["id"]))
+	}
+	return result
+}
+
+func TestApplySearch(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		{"top level string", "world", []string{"1"}},
+		{"case insensitive", "HeLLo", []string{"1", "2", "3"}},
+		{"nested object", "ada", []string{"2"}},
+		{"object inside an array", "hello-go", []string{"3"}},
+		{"string in an array", "go", []string{"3"}},
+		{"numbers aren't text", "12345", []string{}},
+		{"booleans aren't text", "true", []string{}},
+		{"null isn't text", "nil", []string{}},
+		{"keys aren't searched", "author", []string{}},
+		{"surrounding space is ignored", "  world ", []string{"1"}},
+		{"empty query matches everything", " ", []string{"1", "2", "3", "4", "5"}},
+		{"no match", "missing", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(applySearch(searchItems(), tt.q))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("_q=%q got %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+// _q narrows down whatever the filters leave, before sorting and pagination
+func TestGetAllSearch(t *testing.T) {
+	s := newTestService(t)
+	posts := []map[string]any{
+		{"id": "1", "title": "Go tips", "views": 30, "author": map[string]any{"name": "Ada"}},
+		{"id": "2", "title": "Rust tips", "views": 10, "author": map[string]any{"name": "Bob"}},
+		{"id": "3", "title": "More GO", "views": 20, "tags": []any{"beginner"}},
+		{"id": "4", "title": "Cooking", "views": 40, "tags": []any{"go-to recipes"}},
+		{"id": "5", "title": "Gardening", "views": 50},
+	}
+	for _, post := range posts {
+		if _, err := s.Create("posts", post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		filters   map[string]string
+		controls  map[string]string
+		want      []string
+		wantTotal int
+	}{
+		{"search alone", nil, map[string]string{"_q": "go"}, []string{"1", "3", "4"}, 3},
+		{"nested values", nil, map[string]string{"_q": "ADA"}, []string{"1"}, 1},
+		{"with a filter", map[string]string{"views_gte": "25"}, map[string]string{"_q": "go"}, []string{"1", "4"}, 2},
+		{"with _sort", nil, map[string]string{"_q": "go", "_sort": "-views"}, []string{"4", "1", "3"}, 3},
+		{"with pagination", nil, map[string]string{"_q": "go", "_sort": "views", "_per_page": "2", "_page": "2"}, []string{"4"}, 3},
+		{"filter, _sort and pagination", map[string]string{"views_lt": "45"}, map[string]string{"_q": "tips", "_sort": "views", "_per_page": "1"}, []string{"2"}, 2},
+		{"no match", nil, map[string]string{"_q": "nothing"}, []string{}, 0},
+		{"empty search", nil, map[string]string{"_q": ""}, []string{"1", "2", "3", "4", "5"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total, err := s.GetAll("posts", CompileFilters(tt.filters), tt.controls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(items); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("got total %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -2,37 +2,83 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"maps"
 	"strconv"
 
+	"github.com/OleKodehode/go-json-server/internal/config"
 	"github.com/OleKodehode/go-json-server/internal/db"
 	"github.com/OleKodehode/go-json-server/internal/model"
 )
 
 type Service struct {
-	DB *db.DB[model.Data]
+	DB     *db.DB[model.Data]
+	Config config.Config
+
+	counters map[string]*counter // increment counters by collection - Only touched within transactions
 }
 
 var (
 	ErrCollectionNotFound = errors.New("Collection not found")
 	ErrEntryNotFound = errors.New("Entry not found")
+	ErrNotInMemory = db.ErrNotInMemory
+	ErrResourceNotFound = errors.New("Resource not found")
+	ErrIsResource = errors.New("Name belongs to a singular resource, not a collection")
+	ErrIsCollection = errors.New("Name belongs to a collection, not a singular resource")
+	ErrInvalidIndex = errors.New("Invalid index")
 )
 
 // Creates a new instance of the Service struct with an attached Database
 func New(db *db.DB[model.Data]) *Service {
-	return &Service{DB: db}
+	return &Service{DB: db, counters: map[string]*counter{}}
+}
+
+// NewWithConfig creates a Service that generates IDs the way cfg says, collection by collection.
+// The DB should be loaded with cfg.PrimaryKey as its PrimaryKey option, so both agree on the key field.
+func NewWithConfig(db *db.DB[model.Data], cfg config.Config) (*Service, error) {
+	strategies := map[string]string{"defaults": cfg.Defaults.IDStrategy}
+	for name, settings := range cfg.Collections {
+		strategies[name] = settings.IDStrategy
+	}
+	for name, strategy := range strategies {
+		if strategy != "" && !ValidIDStrategy(strategy) {
+			return nil, fmt.Errorf("unknown id strategy %q for %s", strategy, name)
+		}
+	}
+
+	s := New(db)
+	s.Config = cfg
+
+	for name, settings := range cfg.Collections {
+		for _, field := range settings.Indexes {
+			if err := s.AddIndex(name, field); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
 }
 
 // GET /:name -> Returns all entries within the collection
-func (s *Service) GetAll(collection string, filters map[string]string, controls map[string]string) ([]map[string]any, int) {
+// Fails with ErrInvalidFilter if a filter can't be used (an invalid regex etc)
+func (s *Service) GetAll(collection string, filters Filters, controls map[string]string) ([]map[string]any, int, error) {
 	collection = normalizeInput(collection)
 
-	items, exists := s.DB.GetCollection(collection)
+	if err := filters.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	items, exists := s.candidates(collection, filters)
 	if !exists {
-		return []map[string]any{}, 0
+		return []map[string]any{}, 0, nil
 	}
 	
 	items = applyFilters(items, filters)
+	// Full text search - Narrows down the filtered items further
+	if q, ok := controls["_q"]; ok && q != "" {
+		items = applySearch(items, q)
+	}
 	if sortField, ok := controls["_sort"]; ok && sortField != "" {
 		items = sortItems(items, sortField)
 	}
@@ -65,7 +111,7 @@ func (s *Service) GetAll(collection string, filters map[string]string, controls
 	start := (page - 1) * perPage
 	if start >= total {
 		// return nothing, as the start can't be above the total either way.
-		return []map[string]any{}, total
+		return []map[string]any{}, total, nil
 	}
 
 	end := start + perPage
@@ -73,139 +119,278 @@ func (s *Service) GetAll(collection string, filters map[string]string, controls
 		end = total
 	}
 
-	return items[start:end], total
+	// Related entries are only looked up for the page we're returning
+	items = s.applyRelations(collection, items[start:end], controls)
+	return project(items, splitList(controls["_fields"])), total, nil
 }
 
 // GET /:name/:id -> Returns the requsted entry within a collection if it exists
-func (s *Service) GetByID(collection string, id string) map[string]any {
+// Supports the _embed, _expand and _fields controls, same as GetAll.
+func (s *Service) GetByID(collection string, id string, controls map[string]string) map[string]any {
 	collection = normalizeInput(collection)
 
-	items, exists := s.DB.GetCollection(collection)
+	// Looked up through the DB's index - No need to copy or scan the collection
+	entry, exists := s.DB.Find(collection, id)
 	if !exists {
 		return nil
 	}
 
-	entry, i := s.findByID(items, id)
-
-	if i == -1 {
-		return nil
-	}
-
-	return entry
+	items := s.applyRelations(collection, []map[string]any{entry}, controls)
+	return project(items, splitList(controls["_fields"]))[0]
 }
 
 // POST /:name -> Creates a new entry within a collection. Creates a new collection if it doesn't exist
 func (s *Service) Create(collection string, item map[string]any) (map[string]any, error) {
 	collection = normalizeInput(collection)
 
-	// checks if the collection exists and creates it if it doesn't exist
-	s.ensureCollectionExists(collection)
-
-	// get copy of the DB
-	items, exists := s.DB.GetCollection(collection)
-	if !exists { // This shouldn't trigger
-		return nil, ErrCollectionNotFound 
-	}
-	// add the item to the collection
-	if _, ok := item["id"]; !ok {
-		item["id"] = generateID(items)
+	// Everything from reading the collection to saving it happens under the write lock,
+	// so two requests can't end up generating the same ID or dropping each other's entries.
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		return s.insert(tx, collection, item)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	items = append(items, item)
+	// return the item with the added ID field
+	return item, nil
+}
 
-		if err := s.DB.UpdateCollection(collection, items); err != nil {
-		return nil, err
+// insert adds item to a collection within a transaction, generating an ID if it doesn't have one
+func (s *Service) insert(tx *db.Tx[model.Data], collection string, item map[string]any) error {
+	// Can't add entries to a singular resource
+	if _, isResource := tx.GetResource(collection); isResource {
+		return ErrIsResource
 	}
 
-	// return the item with the added ID field and whether the DB saved successfully
-	return item, nil
+	// A missing collection is created on commit
+	key := tx.KeyField(collection)
+	if id, ok := item[key]; ok {
+		s.observeID(tx, collection, id)
+	} else {
+		item[key] = s.nextID(tx, collection)
+	}
+
+	// add the item to the collection
+	tx.Insert(collection, item)
+	return nil
 }
 
 // PUT /:name/:id -> Replaces (or creates) a specific entry within a collection.
-func (s *Service) Replace(collection string, id string, item map[string]any) (map[string]any, error) {
+// A non-empty ifMatch (the If-Match header) has to match the current entry's ETag, or ErrPreconditionFailed is returned.
+func (s *Service) Replace(collection string, id string, item map[string]any, ifMatch string) (map[string]any, error) {
 	collection = normalizeInput(collection)
-	// Check if the collection exists - Return early if it does not
-	items, exists := s.DB.GetCollection(collection)
-	if !exists {
-		return nil, ErrCollectionNotFound
-	}
-	
+
 	// Make a copy instead of the original input
 	itemCopy := maps.Clone(item)
 	// add the ID to the item itself
-	itemCopy["id"] = id
-	
-	// Check if the entry exists (id) - Return early if it does not
-	_, index := s.findByID(items, id)
+	itemCopy[s.DB.KeyField(collection)] = id
 
-	if index != -1 {
-		items[index] = itemCopy
-	} else {
-		// entry didn't exist - Create it
-		items = append(items, itemCopy)
-	}
-	
-	if err := s.DB.UpdateCollection(collection, items); err != nil {
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		// Check if the collection exists - Return early if it does not
+		if !tx.HasCollection(collection) {
+			return ErrCollectionNotFound
+		}
+
+		// Check if the entry exists (id)
+		current, index := tx.Find(collection, id)
+		if err := checkIfMatch(current, ifMatch); err != nil {
+			return err
+		}
+
+		if index != -1 {
+			tx.Replace(collection, index, itemCopy)
+		} else {
+			// entry didn't exist - Create it
+			s.observeID(tx, collection, id)
+			tx.Insert(collection, itemCopy)
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	// Return the updated/created item and whether there were any issues saving the DB
+
+	// Return the updated/created item
 	return itemCopy, nil
 }
 
 // PATCH /:name/:id -> Updates a specific entry in a collection if it exists
-func (s *Service) Update(collection string, id string, fields map[string]any) (map[string]any, error) {
+// ifMatch works the same way as for Replace.
+func (s *Service) Update(collection string, id string, fields map[string]any, ifMatch string) (map[string]any, error) {
 	collection = normalizeInput(collection)
+
+	var item map[string]any
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		var err error
+		item, err = s.update(tx, collection, id, fields, ifMatch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the updated item
+	return item, nil
+}
+
+// update merges fields into an entry within a transaction. Returns the updated entry.
+func (s *Service) update(tx *db.Tx[model.Data], collection string, id string, fields map[string]any, ifMatch string) (map[string]any, error) {
 	// Check if the collection exists - Return early if it does not
-	items, exists := s.DB.GetCollection(collection)
-	if !exists {
+	if !tx.HasCollection(collection) {
 		return nil, ErrCollectionNotFound
 	}
 	// Check if the entry exists (id) - Return early if it does not
-	item, index := s.findByID(items, id)
+	item, index := tx.Find(collection, id)
 	if index == -1 {
 		return nil, ErrEntryNotFound
 	}
+	if err := checkIfMatch(item, ifMatch); err != nil {
+		return nil, err
+	}
 	itemCopy := maps.Clone(item)
+	primaryKey := tx.KeyField(collection)
 	// Update the item with the fields supplied to the function
 	for key, value := range fields {
-		if key == "id" {
+		if key == primaryKey {
 			continue
 		}
 		itemCopy[key] = value
 	}
 
-	items[index] = itemCopy
+	tx.Replace(collection, index, itemCopy)
+	return itemCopy, nil
+}
 
-	if err := s.DB.UpdateCollection(collection, items); err != nil {
+// DELETE /:name/:id -> Deletes a specific entry within a collection if it exists
+// Child entries in the dependent collections (comments with a matching postId etc) are deleted along with it,
+// all in the same write. Returns how many entries were removed from each collection.
+// ifMatch works the same way as for Replace.
+func (s *Service) Delete(collection string, id string, dependents []string, ifMatch string) (map[string]int, error) {
+	collection = normalizeInput(collection)
+	removed := map[string]int{}
+
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		if err := s.remove(tx, collection, id, ifMatch); err != nil {
+			return err
+		}
+		removed[collection] = 1
+
+		// Then everything pointing to it
+		key := foreignKey(collection)
+		for _, dependent := range dependents {
+			dependent = normalizeInput(dependent)
+			// A misspelled dependent would otherwise report 0 removed and leave the children behind
+			children, exists := tx.GetCollection(dependent)
+			if !exists {
+				return fmt.Errorf("%w: %s", ErrCollectionNotFound, dependent)
+			}
+
+			var indexes []int
+			for i, child := range children {
+				if value, ok := child[key]; ok && fmt.Sprint(value) == id {
+					indexes = append(indexes, i)
+				}
+			}
+
+			tx.RemoveMany(dependent, indexes)
+			removed[dependent] += len(indexes)
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Return the updated item and whether there were any issues saving the DB
-	return itemCopy, nil
+	return removed, nil
 }
 
-// DELETE /:name/:id -> Deletes a specific entry within a collection if it exists
-func (s *Service) Delete(collection string, id string) error {
-	collection = normalizeInput(collection)
+// remove deletes a single entry within a transaction
+func (s *Service) remove(tx *db.Tx[model.Data], collection string, id string, ifMatch string) error {
 	// Check if the collection exists - Return early if it does not
-	items, exists := s.DB.GetCollection(collection)
-	if !exists {
+	if !tx.HasCollection(collection) {
 		return ErrCollectionNotFound
 	}
 	// check if the entry exists (id) - Return early if it does not
-
-
-	_, index := s.findByID(items, id)
+	item, index := tx.Find(collection, id)
 
 	if index == -1 {
 		return ErrEntryNotFound
 	}
+	if err := checkIfMatch(item, ifMatch); err != nil {
+		return err
+	}
 	// Delete the entry - Just filter it out based on the ID
-	items = append(items[:index], items[index+1:]...)
+	tx.Remove(collection, index)
+	return nil
+}
 
-	if err := s.DB.UpdateCollection(collection, items); err != nil {
-		return err
+// POST /__reset -> Throws away every change and goes back to the seed data (memory mode only)
+func (s *Service) Reset() error {
+	return s.DB.Reset()
+}
+
+// GET /:name -> Returns a singular resource (an object at the top level of db.json) if it exists
+func (s *Service) GetResource(name string) (map[string]any, bool) {
+	return s.DB.GetResource(normalizeInput(name))
+}
+
+// PUT /:name -> Replaces (or creates) a singular resource
+// A non-empty ifMatch (the If-Match header) has to match the current resource's ETag, or ErrPreconditionFailed is returned.
+func (s *Service) ReplaceResource(name string, item map[string]any, ifMatch string) (map[string]any, error) {
+	name = normalizeInput(name)
+	itemCopy := maps.Clone(item)
+
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		// A name is either a collection or a resource - Never both
+		if tx.HasCollection(name) {
+			return ErrIsCollection
+		}
+		current, _ := tx.GetResource(name)
+		if err := checkIfMatch(current, ifMatch); err != nil {
+			return err
+		}
+
+		tx.SetResource(name, itemCopy)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return itemCopy, nil
+}
+
+// PATCH /:name -> Updates the fields of a singular resource if it exists
+// A non-empty ifMatch (the If-Match header) has to match the current resource's ETag, or ErrPreconditionFailed is returned.
+func (s *Service) UpdateResource(name string, fields map[string]any, ifMatch string) (map[string]any, error) {
+	name = normalizeInput(name)
+
+	var item map[string]any
+	err := s.DB.Transaction(func(tx *db.Tx[model.Data]) error {
+		if tx.HasCollection(name) {
+			return ErrIsCollection
+		}
+
+		// GetResource already hands us a copy
+		current, exists := tx.GetResource(name)
+		if !exists {
+			return ErrResourceNotFound
+		}
+		if err := checkIfMatch(current, ifMatch); err != nil {
+			return err
+		}
+		maps.Copy(current, fields)
+		item = current
+
+		tx.SetResource(name, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
 }
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/OleKodehode/go-json-server/internal/db"
+	"github.com/OleKodehode/go-json-server/internal/model"
+)
+
+// newTestService returns a Service on a fresh database file in a temp directory
+func newTestService(t testing.TB) *Service {
+	t.Helper()
+
+	database, err := db.Load[model.Data](filepath.Join(t.TempDir(), "db.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return New(database)
+}
+
+// Concurrent creates must never hand out the same ID twice or drop each other's entries.
+// Run with -race.
+func TestConcurrentCreates(t *testing.T) {
+	s := newTestService(t)
+
+	const creates = 500
+	ids := make(chan string, creates)
+	var wg sync.WaitGroup
+	for i := range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := s.Create("posts", map[string]any{"n": i})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids <- fmt.Sprint(item["id"])
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[string]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("id %s handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != creates {
+		t.Errorf("got %d ids, want %d", len(seen), creates)
+	}
+
+	// Every acknowledged entry is in memory, and on disk
+	items, _ := s.DB.GetCollection("posts")
+	if len(items) != creates {
+		t.Errorf("got %d entries in memory, want %d", len(items), creates)
+	}
+
+	reloaded, err := db.Load[model.Data](s.DB.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ = reloaded.GetCollection("posts")
+	if len(items) != creates {
+		t.Errorf("got %d entries on disk, want %d", len(items), creates)
+	}
+	for _, item := range items {
+		if !seen[fmt.Sprint(item["id"])] {
+			t.Errorf("entry %v on disk wasn't returned to anyone", item["id"])
+		}
+	}
+}
+
+// Concurrent updates to the same entry all land - None of them is lost to a read-modify-write race
+func TestConcurrentUpdates(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.Create("posts", map[string]any{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const updates = 200
+	var wg sync.WaitGroup
+	for i := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Update("posts", "1", map[string]any{fmt.Sprintf("f%d", i): i}, ""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	item := s.GetByID("posts", "1", nil)
+	// Every field plus the id
+	if len(item) != updates+1 {
+		t.Errorf("got %d fields, want %d", len(item), updates+1)
+	}
+}
+
+// benchSizes are the collection sizes the benchmarks run at
+var benchSizes = []int{100, 10_000, 1_000_000}
+
+// A cascading delete removes the children too - Or nothing at all if a dependent collection doesn't exist
+func TestDeleteDependents(t *testing.T) {
+	s := newTestService(t)
+	for _, entry := range []struct {
+		collection string
+		item       map[string]any
+	}{
+		{"posts", map[string]any{"id": "1"}},
+		{"comments", map[string]any{"id": "1", "postId": "1"}},
+		{"comments", map[string]any{"id": "2", "postId": "2"}},
+		{"comments", map[string]any{"id": "3", "postId": "1"}},
+	} {
+		if _, err := s.Create(entry.collection, entry.item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.Delete("posts", "1", []string{"commnets"}, ""); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("got %v, want ErrCollectionNotFound", err)
+	}
+	if s.GetByID("posts", "1", nil) == nil {
+		t.Fatal("post was deleted along with a dependent that doesn't exist")
+	}
+
+	removed, err := s.Delete("posts", "1", []string{"comments"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"posts": 1, "comments": 2}; !maps.Equal(removed, want) {
+		t.Errorf("got removed %v, want %v", removed, want)
+	}
+}
+
+// benchService returns a Service on an in-memory database seeded with a posts collection of n entries (IDs 1 to n)
+func benchService(b *testing.B, n int) *Service {
+	b.Helper()
+
+	posts := make([]map[string]any, n)
+	for i := range posts {
+		posts[i] = map[string]any{"id": strconv.Itoa(i + 1), "title": fmt.Sprint("post ", i), "views": i}
+	}
+	seed, err := json.Marshal(map[string]any{"posts": posts})
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "db.json")
+	if err := os.WriteFile(path, seed, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	// Memory mode - Nothing is saved, so the benchmarks measure the service and the DB rather than the disk
+	database, err := db.LoadWithOptions[model.Data](path, db.Options{Memory: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { database.Close() })
+
+	return New(database)
+}
+
+func BenchmarkGetByID(b *testing.B) {
+	for _, n := range benchSizes {
+		s := benchService(b, n)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				if s.GetByID("posts", strconv.Itoa(i%n+1), nil) == nil {
+					b.Fatal("entry not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, n := range benchSizes {
+		s := benchService(b, n)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				if _, err := s.Update("posts", strconv.Itoa(i%n+1), map[string]any{"views": i}, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreate(b *testing.B) {
+	for _, n := range benchSizes {
+		s := benchService(b, n)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := range b.N {
+				if _, err := s.Create("posts", map[string]any{"views": i}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -23,9 +23,9 @@ func sortItems(items []map[string]any, sortStr string) []map[string]any {
 
 			var a, b any
 
-			// checks for potential missing values
-			if value, ok := items[i][field]; ok{ a = value }
-			if value, ok := items[j][field]; ok{ b = value }
+			// checks for potential missing values - Dotted paths sort on nested fields (meta.createdAt)
+			if value, ok := resolvePath(items[i], field); ok{ a = value }
+			if value, ok := resolvePath(items[j], field); ok{ b = value }
 
 			// Number comparison first
 			aNumb, aErr := toFloat64(a)
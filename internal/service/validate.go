@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryProblem is something wrong with a single query parameter - Reported instead of silently ignored
+type QueryProblem struct {
+	Parameter string `json:"parameter"`
+	Value     string `json:"value"`
+	Reason    string `json:"reason"`
+}
+
+// numericOperators only ever match numbers, so a filter value that isn't one can't match anything
+var numericOperators = map[string]bool{"gt": true, "gte": true, "lt": true, "lte": true}
+
+// ValidateFilters looks for filters that can never match: numeric comparisons with a value that isn't a number,
+// and values the operator can't use (an invalid regex etc). It only looks at the filters themselves, not the data.
+// The problems are sorted by parameter.
+func ValidateFilters(filters Filters) []QueryProblem {
+	problems := []QueryProblem{}
+
+	for _, f := range filters {
+		if f.err != nil {
+			// The parameter is named already - No need for the "Invalid filter: " prefix
+			reason := strings.TrimPrefix(f.err.Error(), ErrInvalidFilter.Error()+": ")
+			problems = append(problems, QueryProblem{Parameter: f.key, Value: f.value, Reason: reason})
+			continue
+		}
+
+		if numericOperators[f.op] {
+			if _, err := toFloat64(f.value); err != nil {
+				problems = append(problems, QueryProblem{Parameter: f.key, Value: f.value, Reason: fmt.Sprintf("_%s needs a number", f.op)})
+			}
+		}
+	}
+
+	return problems
+}
+
+// UnknownOperators looks for filters with an operator that doesn't exist (views_gtee), which are taken as a plain
+// field and match nothing. Top level fields are known to the DB. Dotted paths (meta.likes_gtee) mean going through
+// every entry, so they're only checked with paths set. The problems are sorted by parameter.
+func (s *Service) UnknownOperators(collection string, filters Filters, paths bool) []QueryProblem {
+	collection = normalizeInput(collection)
+	problems := []QueryProblem{}
+
+	for _, f := range filters {
+		// An operator that was recognised (or _eq) isn't unknown
+		if f.op != "eq" || f.literal != nil {
+			continue
+		}
+		if strings.Contains(f.field, ".") && !paths {
+			continue
+		}
+		if operator, ok := s.unknownOperator(collection, f.field); ok {
+			problems = append(problems, QueryProblem{Parameter: f.key, Value: f.value, Reason: fmt.Sprintf("unknown operator %q", operator)})
+		}
+	}
+
+	return problems
+}
+
+// unknownOperator tells a misspelled operator (views_gtee) apart from a field with an underscore in its name (created_at).
+// It's a typo if the entries have the field before the last underscore, but none of them have the whole key.
+func (s *Service) unknownOperator(collection string, key string) (string, bool) {
+	field, operator, found := cutLast(key, "_")
+	if !found || field == "" || operator == "" {
+		return "", false
+	}
+
+	// Top level keys are answered by the DB, without going through the entries on every request
+	if !strings.Contains(key, ".") {
+		return operator, s.DB.HasField(collection, field) && !s.DB.HasField(collection, key)
+	}
+
+	items, _ := s.DB.GetCollection(collection)
+	hasField := false
+	for _, item := range items {
+		if value, _ := resolvePath(item, key); value != nil {
+			return "", false
+		}
+		if value, _ := resolvePath(item, field); value != nil {
+			hasField = true
+		}
+	}
+
+	return operator, hasField
+}
+
+// cutLast is strings.Cut around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i == -1 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
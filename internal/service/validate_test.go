@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestValidateFilters(t *testing.T) {
+	filters := CompileFilters(map[string]string{
+		"views_gte":   "ten",
+		"email_regex": "(",
+		"done_exists": "maybe",
+		"title":       "ok",
+		"views_lt":    "5",
+	})
+
+	var got []string
+	for _, problem := range ValidateFilters(filters) {
+		got = append(got, problem.Parameter)
+	}
+	if want := []string{"done_exists", "email_regex", "views_gte"}; !slices.Equal(got, want) {
+		t.Errorf("got problems with %v, want %v", got, want)
+	}
+}
+
+func TestUnknownOperators(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.Create("posts", map[string]any{"views": 1, "created_at": "2024", "meta": map[string]any{"likes": 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		paths bool
+		want  bool
+	}{
+		{"views_gtee", false, true},
+		{"created_at", false, false},      // a field with an underscore
+		{"views_gte", false, false},       // a known operator
+		{"missing_gtee", false, false},    // no field to have misspelled an operator for
+		{"meta.likes_gtee", true, true},   // dotted paths
+		{"meta.likes_gtee", false, false}, // only looked at when asked for
+		{"meta.likes", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.key, "/paths=", tt.paths), func(t *testing.T) {
+			problems := s.UnknownOperators("posts", CompileFilters(map[string]string{tt.key: "1"}), tt.paths)
+			if got := len(problems) > 0; got != tt.want {
+				t.Errorf("got %v, want unknown operator %v", problems, tt.want)
+			}
+		})
+	}
+}